@@ -2,21 +2,43 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	b64 "encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	. "fmt"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 	"io/ioutil"
 	"math"
+	"math/big"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // SimpleChaincode example simple Chaincode implementation
 type SimpleModel struct {}
 
+// every organisation has its own private data collection named with this prefix and its MSP ID,
+// e.g. collectionDataFlexOrg1MSP, see collections_config.json
+const dataCollectionPrefix = "collectionDataFlex"
+
+// largest page GetAllModels, GetAllData and GetAllResults return in one response
+const maxPageSize = 200
+
+// page size of GetAllModels, GetAllData and GetAllResults when the caller gives none
+const defaultPageSize = 50
+
 //storage for model
 type Model struct {
 	ObjectType 		string
@@ -34,6 +56,29 @@ type ModelFile struct{
 	ModelType		string `json:"ModelType"`
 	LibraryType string `json:"LibraryType"`
 	ID uint64
+	Hash string `json:"Hash"`
+	Size int64 `json:"Size"`
+	MediaType string `json:"MediaType"`
+	SchemaName string `json:"SchemaName"`
+	BaseName string `json:"BaseName"`
+	Version uint64 `json:"Version"`
+	Parent string `json:"Parent"`
+	Changelog string `json:"Changelog"`
+	Task string `json:"Task"`
+}
+
+// versions published under one model base name, each version is a ModelFile of its own
+type ModelLineage struct{
+	ObjectType 	string `json:"ObjectType"`
+	BaseName string `json:"BaseName"`
+	Owner string `json:"Owner"`
+	DefaultVersion uint64 `json:"DefaultVersion"`
+	LatestVersion uint64 `json:"LatestVersion"`
+}
+
+type ModelLineageWrapper struct{
+	Key    string 	`json:"Key"`
+	Record ModelLineage 	`json:"Record"`
 }
 
 type DataFlex struct{
@@ -43,6 +88,14 @@ type DataFlex struct{
 	Owner string `json:"Owner"`
 	DataName string  `json:"DataName"`
 	ID uint64   `json:"Id"`
+	Hash string `json:"Hash"`
+	Private bool `json:"Private"`
+	Rows int `json:"Rows"`
+	Columns int `json:"Columns"`
+	SchemaName string `json:"SchemaName"`
+	Task string `json:"Task"`
+	ClassLabel string `json:"ClassLabel"`
+	Collection string `json:"Collection"`
 }
 
 type DataCol struct{
@@ -99,17 +152,118 @@ type Results struct{
 
 type ResultsArray struct{
 	ObjectType 	string `json:"ObjectType"`
-	id int64
 	Results []float64 `json:"Results"`
 	ModelName string `json:"ModelName"`
 	DataColName string `json:"DataColName"`
+	TxID string `json:"TxID"`
+	ModelVersion uint64 `json:"ModelVersion"`
+	Task string `json:"Task"`
+}
+
+// rejected data payload, Row is the sample and Column the feature of the wrong cell, -1 when not about one cell
+type DataValidationError struct{
+	Field string `json:"Field"`
+	Row int `json:"Row"`
+	Column int `json:"Column"`
+	Value string `json:"Value"`
+	Reason string `json:"Reason"`
+}
+
+// one modification of a key, Value is the JSON stored by the transaction or null when it deleted the key,
+// CreatorMSP is the MSP of the submitter recorded with the write and empty for writes made before it was recorded
+type HistoryEntry struct{
+	TxID string `json:"TxID"`
+	Timestamp string `json:"Timestamp"`
+	CreatorMSP string `json:"CreatorMSP"`
+	IsDelete bool `json:"IsDelete"`
+	Value json.RawMessage `json:"Value"`
+}
+
+// lifecycle event names, every event of a transaction is sent as one JSON array named after the first event
+const (
+	eventModelRegistered = "ModelRegistered"
+	eventDatasetRegistered = "DatasetRegistered"
+	eventResultsRecorded = "ResultsRecorded"
+	eventValidationFailed = "ValidationFailed"
+)
+
+type LifecycleEvent struct{
+	Type string `json:"Type"`
+	TxID string `json:"TxID"`
+	Model string `json:"Model,omitempty"`
+	Data string `json:"Data,omitempty"`
+	Owner string `json:"Owner,omitempty"`
+	Reason string `json:"Reason,omitempty"`
 }
 
 type ModelValidity struct{
 	ModelValidity    int64 	`json:"modelValidity"`
 }
 
-var resIdCounter int64 = 0
+// pending oracle validation of one model and data pair, results are submitted by an off-chain worker
+type ValidationRequest struct{
+	ObjectType 	string `json:"ObjectType"`
+	ModelName string `json:"ModelName"`
+	DataColName string `json:"DataColName"`
+	ModelHash string `json:"ModelHash"`
+	DataHash string `json:"DataHash"`
+	Status string `json:"Status"`
+	TxID string `json:"TxID"`
+	Reason string `json:"Reason"`
+}
+
+// pending requests carry the oracle endpoint built by the adapter of the model library, it is empty when no oracle is enabled
+type ValidationRequestWrapper struct{
+	Key    string 	`json:"Key"`
+	Record ValidationRequest 	`json:"Record"`
+	OracleUrl string `json:"OracleUrl,omitempty"`
+}
+
+// ordered features a model expects and a dataset provides
+type FeatureSchema struct{
+	ObjectType 	string `json:"ObjectType"`
+	Name string `json:"Name"`
+	Features []SchemaFeature `json:"Features"`
+	Owner string `json:"Owner"`
+}
+
+type SchemaFeature struct{
+	Name string `json:"Name"`
+	Type string `json:"Type"`
+}
+
+type FeatureSchemaWrapper struct{
+	Key    string 	`json:"Key"`
+	Record FeatureSchema 	`json:"Record"`
+}
+
+// competition models and data are submitted to, validation pairs only assets of the same task
+// and the results page ranks them by Metric, stored under "task" + name
+type Task struct{
+	ObjectType string `json:"ObjectType"`
+	Name string `json:"Name"`
+	Description string `json:"Description"`
+	TargetLabel string `json:"TargetLabel"`
+	ModelTypes []string `json:"ModelTypes"`
+	Metric string `json:"Metric"`
+	Deadline string `json:"Deadline"`
+	Owner string `json:"Owner"`
+}
+
+// oracle service endpoint used to validate models of one library type
+// oracle endpoint of a library type, results it returns are signed with the key of the PEM encoded public key
+type OracleRegistry struct{
+	ObjectType 	string `json:"ObjectType"`
+	LibraryType string `json:"LibraryType"`
+	Url string `json:"Url"`
+	Enabled bool `json:"Enabled"`
+	PublicKey string `json:"PublicKey"`
+}
+
+type OracleRegistryWrapper struct{
+	Key    string 	`json:"Key"`
+	Record OracleRegistry 	`json:"Record"`
+}
 
 // ===================================================================================
 // Main chaincode
@@ -126,11 +280,28 @@ func (t *SimpleModel) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	return shim.Success(nil)
 }
 
-// Lists functions available
+// Invoke runs the function and emits lifecycle events it raised once it succeeded
 func (t *SimpleModel) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	function, args := stub.GetFunctionAndParameters()
 	Println("invoke is running " + function)
+	err := authorize(stub, function)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	eventStub := &eventBatchingStub{ChaincodeStubInterface: &creatorRecordingStub{ChaincodeStubInterface: stub}}
 
+	response := t.dispatch(eventStub, function, args)
+	if response.Status == shim.OK {
+		err = eventStub.flushEvents()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return response
+}
+
+// Lists functions available
+func (t *SimpleModel) dispatch(stub shim.ChaincodeStubInterface, function string, args []string) pb.Response {
 	// Handle different functions
 	if function == "initModel" { //create a new model
 		return t.initModel(stub, args)
@@ -148,12 +319,30 @@ func (t *SimpleModel) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return t.getAllResults(stub, args)
 	}else if function == "initModelFile" { //read one model from chaincode stateDB
 		return t.initModelFile(stub, args)
+	}else if function == "initNativeModel" { //store model evaluated by chaincode without oracle
+		return t.initNativeModel(stub, args)
+	}else if function == "publishModelVersion" { //store new version of a model file
+		return t.publishModelVersion(stub, args)
+	}else if function == "publishNativeModelVersion" { //store new version of a native model
+		return t.publishNativeModelVersion(stub, args)
+	}else if function == "setDefaultModelVersion" { //mark version used by default
+		return t.setDefaultModelVersion(stub, args)
+	}else if function == "GetModelVersions" { //read all versions of one model
+		return t.getModelVersions(stub, args)
+	}else if function == "GetAllModelLineages" { //read default and latest versions of all models
+		return t.getAllModelLineages(stub, args)
 	}else if function == "testModelFile" { //read one model from chaincode stateDB
 		return t.testModelFile(stub, args)
 	}else if function == "initDataFile" { //read one model from chaincode stateDB
 		return t.initDataFile(stub, args)
 	}else if function == "initFlexData" { //init test data from cli console arguments
 		return t.initFlexData(stub, args)
+	}else if function == "initPrivateFlexData" { //init data kept in private data collection from transient map
+		return t.initPrivateFlexData(stub, args)
+	}else if function == "ReadData" { //read one data with its private copy where authorised
+		return t.readData(stub, args)
+	}else if function == "EvaluateNativeModel" { //score data with a native model for the off-chain worker
+		return t.evaluateNativeModelQuery(stub, args)
 	}else if function == "insertedModelFile" { //read all data owned by same owner
 		return t.insertedModelFile(stub, args)
 	}else if function == "insertedDataFile" { //read all data owned by same owner
@@ -170,6 +359,46 @@ func (t *SimpleModel) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return t.updateAllModelsAPI(stub, args)
 	}else if function == "testConnection" { //validate Many Models via Oracle
 		return t.testConnection(stub, args)
+	}else if function == "submitValidationResult" { //store oracle results computed off-chain
+		return t.submitValidationResult(stub, args)
+	}else if function == "GetPendingValidations" { //read validation requests waiting for off-chain worker
+		return t.getPendingValidations(stub, args)
+	}else if function == "registerOracle" { //add oracle endpoint for library type
+		return t.registerOracle(stub, args)
+	}else if function == "updateOracle" { //change oracle endpoint of library type
+		return t.updateOracle(stub, args)
+	}else if function == "disableOracle" { //stop routing library type to its oracle
+		return t.disableOracle(stub, args)
+	}else if function == "GetAllOracles" { //read all oracle endpoints from chaincode couchDB
+		return t.getAllOracles(stub, args)
+	}else if function == "registerFeatureSchema" { //add features and their order models and data refer to
+		return t.registerFeatureSchema(stub, args)
+	}else if function == "GetFeatureSchema" { //read one feature schema from chaincode stateDB
+		return t.getFeatureSchemaByName(stub, args)
+	}else if function == "GetAllFeatureSchemas" { //read all feature schemas from chaincode couchDB
+		return t.getAllFeatureSchemas(stub, args)
+	}else if function == "GetHistoryForKey" { //read all modifications of a model, data or results key
+		return t.getHistoryForKey(stub, args)
+	}else if function == "GetSkippedValidations" { //read model and data pairs skipped as incompatible
+		return t.getSkippedValidations(stub, args)
+	}else if function == "createTask" { //add a task models and data are submitted to
+		return t.createTask(stub, args)
+	}else if function == "GetTask" { //read one task from chaincode stateDB
+		return t.getTaskByName(stub, args)
+	}else if function == "GetAllTasks" { //read all tasks from chaincode couchDB
+		return t.getAllTasks(stub, args)
+	}else if function == "mintTokens" { //create reward tokens for an identity
+		return t.mintTokens(stub, args)
+	}else if function == "transferTokens" { //move reward tokens from the submitter to another identity
+		return t.transferTokens(stub, args)
+	}else if function == "distributeRewards" { //split reward pool by Shapley values of an evaluation round
+		return t.distributeRewards(stub, args)
+	}else if function == "GetTokenBalance" { //read reward token balance of one identity
+		return t.getTokenBalance(stub, args)
+	}else if function == "GetAllTokenAccounts" { //read all reward token balances from chaincode couchDB
+		return t.getAllTokenAccounts(stub, args)
+	}else if function == "GetAllRewardRounds" { //read all distributed reward rounds from chaincode couchDB
+		return t.getAllRewardRounds(stub, args)
 	}
 
 	Println("invoke did not find func: " + function) //error
@@ -204,8 +433,7 @@ func (t *SimpleModel) validateModel(stub shim.ChaincodeStubInterface, args []str
 			arrayOfResults = append(arrayOfResults, result)
 		}
 	}
-	t.initResults(stub,args, modelName,data[0].Record.DataName, arrayOfResults)
-	return shim.Success(nil)
+	return t.initResults(stub,args, modelName,data[0].Record.DataName, arrayOfResults)
 }
 
 /*func (t *SimpleModel) validateModelAPI(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -236,7 +464,10 @@ func (t *SimpleModel) validateModel(stub shim.ChaincodeStubInterface, args []str
 
 	payloadbytes, err := json.Marshal(payload)
 
-	responseBytes := HttpPost(url,payloadbytes)
+	responseBytes, err := HttpPost(url,payloadbytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	json.Unmarshal(responseBytes, &results)
 
@@ -247,10 +478,7 @@ func (t *SimpleModel) validateModel(stub shim.ChaincodeStubInterface, args []str
 func (t *SimpleModel) validateModelFileAPI(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	modelName:= args[0]
 	dataColId:= args[1]
-	var results Results
-	var payload FilePayload
 	var modelJson ModelFile
-	var data DataFlex
 
 	//getting model stored in couchDB-------------------
 	modelBytes, err := stub.GetState(modelName)
@@ -259,58 +487,53 @@ func (t *SimpleModel) validateModelFileAPI(stub shim.ChaincodeStubInterface, arg
 	}
 	//--------------------------------------------------
 	//getting data stored in couchDB--------------------
-	dataBytes, err := stub.GetState(dataColId)
+	data, err := getDataFlex(stub, dataColId)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 	//--------------------------------------------------
 
-	// setting the ip address of API
-	ip :="http://192.168.144.2:8080/"
-
-	json.Unmarshal((dataBytes), &data)
+	json.Unmarshal((modelBytes), &modelJson)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//--------------------------------------------------
+	if modelJson.Task != data.Task {
+		return shim.Error("Model " + modelName + " and data " + dataColId + " are submitted to different tasks")
+	}
 
-	json.Unmarshal((modelBytes), &modelJson)
+	reason, err := featureSchemaCompatibility(stub, modelJson, data)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if reason != "" {
+		err = recordSkippedValidation(stub, modelJson, data, reason)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success([]byte(reason))
+	}
 
-	payload.Model = modelJson
-	payload.Data = data
+	// only validation request is recorded for pairs the worker validates, it submits the results later
+	if needsValidationRequest(modelJson, data) {
+		err = recordValidationRequest(stub, modelJson, data)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(nil)
+	}
 
 	//get validation results---------------
-	url := ip + "apiValidate"+ modelJson.ModelType
-
-	payloadJson, err := json.Marshal(payload)
-
-	responseBytes := HttpPost(url,payloadJson)
-
-	err = json.Unmarshal(responseBytes, &results)
+	predictions, err := evaluateNativeModel(modelJson, data)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	t.initResults(stub,args, modelName, data.DataName ,results.ArrayOfResults )
-	return shim.Success(nil)
+	return t.initResults(stub,args, modelName, data.DataName ,predictions )
 }
 
 func (t *SimpleModel) insertedModelFile(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	modelName:= args[0]
-	var results Results
-	var payload FilePayload
 	var modelJson ModelFile
 
-	//--------------------------------------------------
-
-	// setting the ip address of API
-	SparkIp :="http://192.168.144.2:8080/"
-	MLR3Ip := "http://192.168.144.3:1030/"
-
-	//--------------------------------------------------
-
 	//getting model stored in couchDB-------------------
 	modelBytes, err := stub.GetState(modelName)
 	if err != nil {
@@ -321,12 +544,14 @@ func (t *SimpleModel) insertedModelFile(stub shim.ChaincodeStubInterface, args [
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	payload.Model = modelJson
 
 	//--------------------------------------------------
 	//getting data stored in couchDB--------------------
 	var wrappedData[]DataFlexWrapper
-	queryString := "{\"selector\":{\"ObjectType\": \"dataColumns\"}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}"
+	queryString, err := taskQueryString("dataColumns", modelJson.Task)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	queryResults, err := getQueryResultForQueryString(stub, queryString)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -336,76 +561,69 @@ func (t *SimpleModel) insertedModelFile(stub shim.ChaincodeStubInterface, args [
 		return shim.Error(err.Error())
 	}
 
-	url := SparkIp+"apiValidate"+ modelJson.ModelType
-	if modelJson.LibraryType == "MLR3"{
-		url = MLR3Ip + "apiValidate"
+	// incompatible data is not sent to the oracle, reason is recorded instead
+	var compatibleData []DataFlexWrapper
+	for i := 0; i < len(wrappedData); i++ {
+		// data of other tasks is never paired with the model
+		if wrappedData[i].Record.Task != modelJson.Task {
+			continue
+		}
+		reason, err := featureSchemaCompatibility(stub, modelJson, wrappedData[i].Record)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if reason != "" {
+			err = recordSkippedValidation(stub, modelJson, wrappedData[i].Record, reason)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			continue
+		}
+		compatibleData = append(compatibleData, wrappedData[i])
 	}
+	wrappedData = compatibleData
+
 	//get validation results for each data---------------
 	for i := 0; i < len(wrappedData); i++ {
 		currentData := wrappedData[i].Record
-		payload.Data = 	currentData
 
-		payloadJson, err := json.Marshal(payload)
-		responseBytes := HttpPost(url,payloadJson)
-		if modelJson.LibraryType == "AS" {
-			err = json.Unmarshal(responseBytes, &results)
+		// only validation requests are recorded for pairs the worker validates, it submits the results later
+		if needsValidationRequest(modelJson, currentData) {
+			err = recordValidationRequest(stub, modelJson, currentData)
 			if err != nil {
 				return shim.Error(err.Error())
 			}
+			continue
 		}
-		if modelJson.LibraryType == "MLR3" {
-			stringFromBytes := string(responseBytes)
-			cleanString := stringFromBytes
-			cleanString = cleanString[1:len(cleanString)-1]
-			s := strings.Split(cleanString, ",")
-			floatResultsArray := []float64{}
-				for i := 0; i < len(s); i++ {
-					if i % 2 != 0{
-						currentString := strings.Replace(s[i], "[", "", -1)
-						currentString = strings.Replace(currentString, "]", "", -1)
-						if n, err := strconv.ParseFloat(currentString, 64); err == nil {
-							floatResultsArray = append(floatResultsArray, n)
-						}
-					}
-				}
-			results.ArrayOfResults = floatResultsArray
+
+		predictions, err := evaluateNativeModel(modelJson, currentData)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		response := t.initResults(stub,args, modelName, currentData.DataName ,predictions)
+		if response.Status != shim.OK {
+			return response
 		}
-		t.initResults(stub,args, modelName, currentData.DataName ,results.ArrayOfResults)
 	}
 	return shim.Success(nil)
 }
 
 func (t *SimpleModel) insertedDataFile(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	dataName := args[0]
-	var results Results
-	var payload FilePayload
-	var dataJson DataFlex
-
-	//--------------------------------------------------
-
-	// setting the ip address of API
-	// setting the ip address of API
-	SparkIp :="http://192.168.144.2:8080/"
-	MLR3Ip := "http://192.168.144.3:1030/"
-
-	//--------------------------------------------------
 
 	//getting model stored in couchDB-------------------
-	dataBytes, err := stub.GetState(dataName)
+	dataJson, err := getDataFlex(stub, dataName)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	err =json.Unmarshal(dataBytes, &dataJson)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	payload.Data= dataJson
-
 	//--------------------------------------------------
 	//getting data stored in couchDB--------------------
 	var wrappedModel[]ModelWrapper
-	queryString :="{\"selector\":{\"ObjectType\": \"modelFile\"}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}"
+	queryString, err := taskQueryString("modelFile", dataJson.Task)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	queryResults, err := getQueryResultForQueryString(stub, queryString)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -415,93 +633,120 @@ func (t *SimpleModel) insertedDataFile(stub shim.ChaincodeStubInterface, args []
 		return shim.Error(err.Error())
 	}
 
+	// incompatible models are not sent to the oracle, reason is recorded instead
+	var compatibleModels []ModelWrapper
 	for i := 0; i < len(wrappedModel); i++ {
-		currentModel := wrappedModel[i].Record
-		payload.Model = currentModel
-
-		//get validation results for each data---------------
-		url := SparkIp + "apiValidate" + currentModel.ModelType
-		if currentModel.LibraryType == "MLR3" {
-			url = MLR3Ip + "apiValidate"
+		// models of other tasks are never paired with the data
+		if wrappedModel[i].Record.Task != dataJson.Task {
+			continue
+		}
+		reason, err := featureSchemaCompatibility(stub, wrappedModel[i].Record, dataJson)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if reason != "" {
+			err = recordSkippedValidation(stub, wrappedModel[i].Record, dataJson, reason)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			continue
 		}
-		payloadJson, err := json.Marshal(payload)
+		compatibleModels = append(compatibleModels, wrappedModel[i])
+	}
+	wrappedModel = compatibleModels
 
-		responseBytes := HttpPost(url, payloadJson)
+	for i := 0; i < len(wrappedModel); i++ {
+		currentModel := wrappedModel[i].Record
 
-		if currentModel.LibraryType == "AS" {
-			err = json.Unmarshal(responseBytes, &results)
+		// only validation requests are recorded for pairs the worker validates, it submits the results later
+		if needsValidationRequest(currentModel, dataJson) {
+			err = recordValidationRequest(stub, currentModel, dataJson)
 			if err != nil {
 				return shim.Error(err.Error())
 			}
+			continue
 		}
-		if currentModel.LibraryType == "MLR3" {
-			stringFromBytes := string(responseBytes)
-			cleanString := stringFromBytes
-			cleanString = cleanString[1 : len(cleanString)-1]
-			s := strings.Split(cleanString, ",")
-			floatResultsArray := []float64{}
-			for i := 0; i < len(s); i++ {
-				if i%2 != 0 {
-					currentString := strings.Replace(s[i], "[", "", -1)
-					currentString = strings.Replace(currentString, "]", "", -1)
-					if n, err := strconv.ParseFloat(currentString, 64); err == nil {
-						floatResultsArray = append(floatResultsArray, n)
-					}
-				}
-			}
-			results.ArrayOfResults = floatResultsArray
+
+		//get validation results for each data---------------
+		predictions, err := evaluateNativeModel(currentModel, dataJson)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		response := t.initResults(stub, args, currentModel.Name, dataJson.DataName, predictions)
+		if response.Status != shim.OK {
+			return response
 		}
-		t.initResults(stub, args, currentModel.Name, dataJson.DataName, results.ArrayOfResults)
 	}
 	return shim.Success(nil)
 }
 
+// testModelFile asks the oracle if it can load the model, the oracle fetches the file from the blob store by its hash
 func (t *SimpleModel) testModelFile(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	modelFile := args[0]
-	modelType := args[1]
-	libraryType := args[2]
+	//   	    0           1             2             3     4
+	//   sha256Hex, "20480", "application/zip", "DT", "AS"
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting file hash, file size, media type, model type and library type")
+	}
+	fileHash := strings.ToLower(args[0])
+	size, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mediaType := args[2]
+	modelType := args[3]
+	libraryType := args[4]
 
 	var payload FilePayload
 
-	var inputValidationResults ModelValidity
-	//getting model stored in couchDB-------------------
+	hashBytes, err := hex.DecodeString(fileHash)
+	if err != nil || len(hashBytes) != sha256.Size {
+		return shim.Error("Model file hash is not a SHA-256 hex digest: " + args[0])
+	}
 
-	modelJson := &ModelFile{"testModel", "test", modelFile, "none", modelType,libraryType,0,}
+	modelJson := &ModelFile{"testModel", "test", "", "none", modelType,libraryType,0,fileHash,size,mediaType,"","",0,"","",""}
 
-	// setting the ip address of API
-	SparkIp :="http://192.168.144.2:8080/"
-	MLR3Ip := "http://192.168.144.3:1030/"
+	adapter, err := getLibraryAdapter(libraryType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// getting the ip address of API from oracle registry
+	ip, err := getOracleUrl(stub, libraryType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	//get validation results---------------
-	url := SparkIp+"apiTest"+ modelType
-	if libraryType == "MLR3"{
-		url = MLR3Ip + "apiTest"
+	payload.Model = *modelJson
+	payloadJson, err := adapter.EncodeRequest(payload)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	payload.Model = *modelJson
-	payloadJson, _ := json.Marshal(payload)
-
-	responseBytes := HttpPost(url,payloadJson)
-	if libraryType == "MLR3" {
-		stringFromBytes := string(responseBytes)
-		cleanString := strings.Replace(stringFromBytes, "\\", "", -1)
-		cleanString = cleanString[1 : len(cleanString)-1]
-		json.Unmarshal([]byte(cleanString), &inputValidationResults)
-	}else{
-		json.Unmarshal(responseBytes, &inputValidationResults)
+	responseBytes, err := HttpPost(adapter.BuildUrl(ip, "apiTest", modelType),payloadJson)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
+	// response the oracle can not be understood is treated as invalid model
+	valid, err := adapter.DecodeValidity(responseBytes)
 
 	response := make([]byte, 64)
 	binary.BigEndian.PutUint64(response, 0)
-	if inputValidationResults.ModelValidity != 0{
+	if err == nil && valid {
 		binary.BigEndian.PutUint64(response, 1)
 	}
 	return shim.Success(response)
 }
 
 func (t *SimpleModel) testConnection(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-
-	url:="http://192.168.144.2:8081/apiValidateDT"
+	libraryType := "AS"
+	if len(args) > 0 {
+		libraryType = args[0]
+	}
+	ip, err := getOracleUrl(stub, libraryType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	url:= ip + "apiValidateDT"
 	HttpGet(url)
 	return shim.Success(nil)
 }
@@ -550,31 +795,82 @@ func (t *SimpleModel) updateAllModels(stub shim.ChaincodeStubInterface, args []s
 	return shim.Success(nil)
 }
 
+// args are optional: pageSize, bookmark, owner, modelType, libraryType, model base name, task, empty filters match everything
 func (t *SimpleModel) getAllModels(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	queryString :="{\"selector\":{\"ObjectType\": \"modelFile\"}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}"
-	queryResults, err := getQueryResultForQueryString(stub, queryString)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	return shim.Success(queryResults)
+	return getFilteredQueryResult(stub, "modelFile", args, []string{"Owner", "ModelType", "LibraryType", "BaseName", "Task"})
 }
 
+// args are optional: pageSize, bookmark, owner, dataset name, task
 func (t *SimpleModel) getAllData(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	queryString :="{\"selector\":{\"ObjectType\": \"dataColumns\"}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}"
-	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	return getFilteredQueryResult(stub, "dataColumns", args, []string{"Owner", "DataName", "Task"})
+}
+
+// args are optional: pageSize, bookmark, model name, dataset name, task
+func (t *SimpleModel) getAllResults(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	return getFilteredQueryResult(stub, "results", args, []string{"ModelName", "DataColName", "Task"})
+}
+
+// getFilteredQueryResult reads pageSize and bookmark followed by one value for each filter field,
+// without a page size the first defaultPageSize records are returned with the bookmark of the next page
+func getFilteredQueryResult(stub shim.ChaincodeStubInterface, objectType string, args []string, filterFields []string) pb.Response {
+	if len(args) > len(filterFields)+2 {
+		return shim.Error("Incorrect number of arguments. Expecting pageSize, bookmark and " + strings.Join(filterFields, ", "))
+	}
+	var pageSize int64 = defaultPageSize
+	var err error
+	if len(args) > 0 && args[0] != "" && args[0] != "0" {
+		pageSize, err = strconv.ParseInt(args[0], 10, 32)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return shim.Error(Sprintf("Page size must be a number from 1 to %d", maxPageSize))
+		}
+	}
+	bookmark := ""
+	if len(args) > 1 {
+		bookmark = args[1]
+	}
+	filters := make(map[string]string)
+	for i := 2; i < len(args); i++ {
+		if args[i] != "" {
+			filters[filterFields[i-2]] = args[i]
+		}
+	}
+
+	queryString, err := selectorQueryString(objectType, filters)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	queryResults, err := getQueryResultForQueryStringWithPagination(stub, queryString, int32(pageSize), bookmark)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 	return shim.Success(queryResults)
 }
 
-func (t *SimpleModel) getAllResults(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	queryString :="{\"selector\":{\"ObjectType\": \"results\"}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}"
-	queryResults, err := getQueryResultForQueryString(stub, queryString)
+// taskQueryString selects assets of the task, records from before tasks have no Task field
+// so assets without a task are selected by object type alone and filtered by the caller
+func taskQueryString(objectType string, taskName string) (string, error) {
+	filters := make(map[string]string)
+	if taskName != "" {
+		filters["Task"] = taskName
+	}
+	return selectorQueryString(objectType, filters)
+}
+
+// selectorQueryString marshals the selector so filter values cannot change the query
+func selectorQueryString(objectType string, filters map[string]string) (string, error) {
+	selector := map[string]string{"ObjectType": objectType}
+	for field, value := range filters {
+		selector[field] = value
+	}
+	query := map[string]interface{}{
+		"selector":  selector,
+		"use_index": []string{"indexOwnerDoc", "indexOwner"},
+	}
+	queryBytes, err := json.Marshal(query)
 	if err != nil {
-		return shim.Error(err.Error())
+		return "", err
 	}
-	return shim.Success(queryResults)
+	return string(queryBytes), nil
 }
 
 func (t *SimpleModel) updateAllModelsAPI(stub shim.ChaincodeStubInterface, args []string) pb.Response {
@@ -583,8 +879,11 @@ func (t *SimpleModel) updateAllModelsAPI(stub shim.ChaincodeStubInterface, args
 	var results Results
 	var payload Payload
 
-	// setting the ip address of API
-	ip := "http://192.168.144.0:8081/"
+	// getting the ip address of API from oracle registry
+	ip, err := getOracleUrl(stub, "AS")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	//getting data stored in couchDB--------------------
 	queryString := Sprintf("{\"selector\":{\"ObjectType\": \"data\",\"Owner\": \"%s\"}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}", dataOwner)
@@ -607,7 +906,13 @@ func (t *SimpleModel) updateAllModelsAPI(stub shim.ChaincodeStubInterface, args
 	payload.Model = modelsJson
 
 	payloadbytes, err := json.Marshal(payload)
-	responseBytes := HttpPost(url,payloadbytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	responseBytes, err := HttpPost(url,payloadbytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	//Parsing json form Oracle results and storing them to blockchain
 	err = json.Unmarshal(responseBytes, &results)
@@ -618,57 +923,1875 @@ func (t *SimpleModel) updateAllModelsAPI(stub shim.ChaincodeStubInterface, args
 	return shim.Success(nil)
 }
 
-//Methods to read data form Blockchain ------------------------------------------------------------------------
+//Methods for off-chain oracle validation -----------------------------------------------------------------------
 
-func (t *SimpleModel) queryDataByOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+// needsValidationRequest tells if the off-chain worker validates the pair, endorsement never calls an oracle
+// as peers could get different answers, nor reads private data as peers of other organisations do not hold it,
+// so only native models on public data are evaluated by the chaincode itself
+func needsValidationRequest(model ModelFile, data DataFlex) bool {
+	return data.Private || !isNativeModel(model)
+}
 
-	if len(args) < 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
-	}
+// models uploaded to the blob store keep only their hash on the ledger
+func isBlobModel(model ModelFile) bool {
+	return model.File == "" && model.Hash != ""
+}
 
-	owner := args[0]
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
 
-	queryString := Sprintf("{\"selector\":{\"ObjectType\": \"data\",\"Owner\": \"%s\"}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}", owner)
-	queryResults, err := getQueryResultForQueryString(stub, queryString)
+// hash of the model file, blob store models are hashed over raw file bytes and inline ones over base64
+func modelFileHash(model ModelFile) string {
+	if model.Hash != "" {
+		return model.Hash
+	}
+	return sha256Hex([]byte(model.File))
+}
 
+// hash of the data table and its class labels
+func dataFlexHash(data DataFlex) (string, error) {
+	if data.Hash != "" {
+		return data.Hash, nil
+	}
+	contentBytes, err := json.Marshal(struct{
+		Data [][]string `json:"DataTable"`
+		Class []string `json:"Class"`
+	}{data.Data, data.Class})
 	if err != nil {
-		return shim.Error(err.Error())
+		return "", err
 	}
-	return shim.Success(queryResults)
+	return sha256Hex(contentBytes), nil
 }
 
-func (t *SimpleModel) readModel(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var name, jsonResp string
-	var err error
+// oracle signs its response together with hashes of the model and data it was calculated for
+func validationMessage(modelHash string, dataHash string, response string) []byte {
+	return []byte(modelHash + ":" + dataHash + ":" + response)
+}
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting name of the marble to query")
-	}
+type ecdsaSignature struct {
+	R, S *big.Int
+}
 
-	name = args[0]
-	valAsbytes, err := stub.GetState(name) //read model from chaincode state
+// parseOraclePublicKey reads the PEM encoded ECDSA public key an oracle signs its responses for
+func parseOraclePublicKey(publicKeyPEM string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, Errorf("Oracle public key is not PEM encoded")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		jsonResp = "{\"Error\":\"Failed to get state for " + name + "\"}"
-		return shim.Error(jsonResp)
-	} else if valAsbytes == nil {
-		jsonResp = "{\"Error\":\"Model does not exist: " + name + "\"}"
-		return shim.Error(jsonResp)
+		return nil, err
 	}
-	return shim.Success(valAsbytes)
+	ecdsaKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, Errorf("Oracle public key is not an ECDSA key")
+	}
+	return ecdsaKey, nil
 }
 
-// ID getting method is performance heavy, bet view creation from chaincode is hard so for the sake of the prototype its implemented by reading all entries and geeting the last one's ID
-func (t *SimpleModel) GetModelID(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var err error
- 	modelOwner:= args[0]
-	responseBytes := make([]byte, 64)
-	var wrappedModel []ModelWrapper
-	queryString := Sprintf("{\"selector\":{\"ObjectType\": \"modelFile\",\"Owner\": \"%s\"}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}", modelOwner)
-	queryResults, err := getQueryResultForQueryString(stub, queryString)
+// verifyOracleSignature checks base64 encoded ASN.1 ECDSA signature of the message over its SHA-256 digest
+func verifyOracleSignature(publicKeyPEM string, message []byte, signature string) error {
+	var sig ecdsaSignature
+	publicKey, err := parseOraclePublicKey(publicKeyPEM)
 	if err != nil {
-		return shim.Error(err.Error())
+		return err
 	}
-	err = json.Unmarshal(queryResults, &wrappedModel)
+	signatureBytes, err := b64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return Errorf("Oracle signature is not base64 encoded")
+	}
+	rest, err := asn1.Unmarshal(signatureBytes, &sig)
+	if err != nil || len(rest) != 0 || sig.R == nil || sig.S == nil {
+		return Errorf("Oracle signature is malformed")
+	}
+	digest := sha256.Sum256(message)
+	if !ecdsa.Verify(publicKey, digest[:], sig.R, sig.S) {
+		return Errorf("Oracle signature does not match the response")
+	}
+	return nil
+}
+
+func validationRequestKey(modelName string, dataName string) string {
+	return "validation" + modelName + "_" + dataName
+}
+
+func recordValidationRequest(stub shim.ChaincodeStubInterface, model ModelFile, data DataFlex) error {
+	dataHash, err := dataFlexHash(data)
+	if err != nil {
+		return err
+	}
+	request := &ValidationRequest{"validationRequest", model.Name, data.DataName, modelFileHash(model), dataHash, "pending", stub.GetTxID(), ""}
+	requestAsBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(validationRequestKey(model.Name, data.DataName), requestAsBytes)
+}
+
+// recordSkippedValidation keeps the reason a model and data pair was not sent to the oracle
+func recordSkippedValidation(stub shim.ChaincodeStubInterface, model ModelFile, data DataFlex, reason string) error {
+	dataHash, err := dataFlexHash(data)
+	if err != nil {
+		return err
+	}
+	request := &ValidationRequest{"validationRequest", model.Name, data.DataName, modelFileHash(model), dataHash, "skipped", stub.GetTxID(), reason}
+	requestAsBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	err = stub.PutState(validationRequestKey(model.Name, data.DataName), requestAsBytes)
+	if err != nil {
+		return err
+	}
+	return emitLifecycleEvent(stub, LifecycleEvent{Type: eventValidationFailed, Model: model.Name, Data: data.DataName, Reason: reason})
+}
+
+// getPendingValidations returns pending requests with the oracle endpoint the worker calls for each of them
+func (t *SimpleModel) getPendingValidations(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var wrappedRequests []ValidationRequestWrapper
+	queryString :="{\"selector\":{\"ObjectType\": \"validationRequest\",\"Status\": \"pending\"}}"
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = json.Unmarshal(queryResults, &wrappedRequests)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for i := range wrappedRequests {
+		wrappedRequests[i].OracleUrl, err = validationEndpoint(stub, wrappedRequests[i].Record.ModelName)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	wrappedRequestsAsBytes, err := json.Marshal(wrappedRequests)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(wrappedRequestsAsBytes)
+}
+
+// validationEndpoint builds the apiValidate endpoint for the model, a library without an enabled oracle has none
+func validationEndpoint(stub shim.ChaincodeStubInterface, modelName string) (string, error) {
+	var model ModelFile
+	modelBytes, err := stub.GetState(modelName)
+	if err != nil {
+		return "", err
+	} else if modelBytes == nil {
+		return "", Errorf("Model does not exist: %s", modelName)
+	}
+	err = json.Unmarshal(modelBytes, &model)
+	if err != nil {
+		return "", err
+	}
+	adapter, err := getLibraryAdapter(model.LibraryType)
+	if err != nil {
+		return "", nil
+	}
+	oracleUrl, err := getOracleUrl(stub, model.LibraryType)
+	if err != nil {
+		return "", nil
+	}
+	return adapter.BuildUrl(oracleUrl, "apiValidate", model.ModelType), nil
+}
+
+func (t *SimpleModel) getSkippedValidations(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	queryString :="{\"selector\":{\"ObjectType\": \"validationRequest\",\"Status\": \"skipped\"}}"
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+// submitValidationResult verifies oracle response computed off-chain against stored model and data hashes
+// and the signature of the registered oracle before the decoded predictions are stored as results
+func (t *SimpleModel) submitValidationResult(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0          1            2           3          4          5
+	//   "Model0", "dataCol0", modelHash, dataHash, response, signature
+	var request ValidationRequest
+	var modelJson ModelFile
+	var dataJson DataFlex
+	if len(args) != 6 {
+		return shim.Error("Incorrect number of arguments. Expecting model name, data name, model hash, data hash, oracle response and oracle signature")
+	}
+	modelName := args[0]
+	dataName := args[1]
+	modelHash := args[2]
+	dataHash := args[3]
+	response := args[4]
+	signature := args[5]
+
+	requestBytes, err := stub.GetState(validationRequestKey(modelName, dataName))
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if requestBytes == nil {
+		return shim.Error("Validation was not requested for model " + modelName + " and data " + dataName)
+	}
+	err = json.Unmarshal(requestBytes, &request)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if request.Status != "pending" {
+		return shim.Error("Validation of model " + modelName + " and data " + dataName + " is already " + request.Status)
+	}
+
+	modelBytes, err := stub.GetState(modelName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = json.Unmarshal(modelBytes, &modelJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	dataBytes, err := stub.GetState(dataName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = json.Unmarshal(dataBytes, &dataJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// submission must refer to the model and data as they are stored now and as they were requested
+	storedDataHash, err := dataFlexHash(dataJson)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if modelHash != modelFileHash(modelJson) || modelHash != request.ModelHash {
+		return shim.Error("Model hash does not match stored model: " + modelName)
+	}
+	if dataHash != storedDataHash || dataHash != request.DataHash {
+		return shim.Error("Data hash does not match stored data: " + dataName)
+	}
+	// only the oracle registered for the library holds the key the response is signed with
+	oracle, err := getOracle(stub, modelJson.LibraryType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = verifyOracleSignature(oracle.PublicKey, validationMessage(modelHash, dataHash, response), signature)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	adapter, err := getLibraryAdapter(modelJson.LibraryType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	predictions, err := adapter.DecodePredictions([]byte(response))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(predictions) != dataRows(dataJson) {
+		return shim.Error(Sprintf("Oracle returned %d predictions for %d data rows", len(predictions), dataRows(dataJson)))
+	}
+
+	request.Status = "completed"
+	requestAsBytes, err := json.Marshal(request)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(validationRequestKey(modelName, dataName), requestAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return t.initResults(stub, args, modelName, dataName, predictions)
+}
+
+//Native models ----------------------------------------------------------------------------------------------------
+
+// library type of models stored as JSON and evaluated by the chaincode itself
+const nativeLibraryType = "GO"
+
+// deepest decision tree accepted, keeps evaluation cost bounded
+const maxTreeDepth = 64
+
+// logistic regression with one coefficient per feature,
+// stored as {"Intercept": -1.2, "Coefficients": [0.4, 2.1]}
+type LogisticModel struct{
+	Intercept float64 `json:"Intercept"`
+	Coefficients []float64 `json:"Coefficients"`
+}
+
+// decision tree node, rows with Feature value up to Threshold go Left and others Right,
+// a node without children is a leaf holding probability of class 1 in Value
+// {"Feature": 0, "Threshold": 1.5, "Left": {"Value": 0.1}, "Right": {"Value": 0.9}}
+type TreeNode struct{
+	Feature int `json:"Feature"`
+	Threshold float64 `json:"Threshold"`
+	Value float64 `json:"Value"`
+	Left *TreeNode `json:"Left,omitempty"`
+	Right *TreeNode `json:"Right,omitempty"`
+}
+
+// NativeModel scores one row of feature values
+type NativeModel interface {
+	Features() int
+	Predict(row []float64) float64
+}
+
+func (m LogisticModel) Features() int {
+	return len(m.Coefficients)
+}
+
+func (m LogisticModel) Predict(row []float64) float64 {
+	sum := m.Intercept
+	for i, coefficient := range m.Coefficients {
+		sum += coefficient * row[i]
+	}
+	return 1 / (1 + math.Exp(-sum))
+}
+
+// Features of a tree is one more than the highest feature index it splits on
+func (n *TreeNode) Features() int {
+	if n.Left == nil {
+		return 0
+	}
+	features := n.Feature + 1
+	if left := n.Left.Features(); left > features {
+		features = left
+	}
+	if right := n.Right.Features(); right > features {
+		features = right
+	}
+	return features
+}
+
+func (n *TreeNode) Predict(row []float64) float64 {
+	node := n
+	for node.Left != nil {
+		if row[node.Feature] <= node.Threshold {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+	}
+	return node.Value
+}
+
+func validateTree(node *TreeNode, depth int) error {
+	if depth > maxTreeDepth {
+		return Errorf("Decision tree is deeper than %d", maxTreeDepth)
+	}
+	if (node.Left == nil) != (node.Right == nil) {
+		return Errorf("Decision tree node at depth %d must have both children or none", depth)
+	}
+	if node.Left == nil {
+		if node.Value < 0 || node.Value > 1 || math.IsNaN(node.Value) {
+			return Errorf("Decision tree leaf at depth %d has value %v, expecting probability", depth, node.Value)
+		}
+		return nil
+	}
+	if node.Feature < 0 {
+		return Errorf("Decision tree node at depth %d splits on negative feature %d", depth, node.Feature)
+	}
+	err := validateTree(node.Left, depth+1)
+	if err != nil {
+		return err
+	}
+	return validateTree(node.Right, depth+1)
+}
+
+// parseNativeModel reads JSON definition of the model type, "LR" or "DT"
+func parseNativeModel(modelType string, definition string) (NativeModel, error) {
+	decoder := json.NewDecoder(strings.NewReader(definition))
+	decoder.DisallowUnknownFields()
+	switch modelType {
+	case "LR":
+		var model LogisticModel
+		err := decoder.Decode(&model)
+		if err != nil {
+			return nil, Errorf("Malformed logistic regression: %s", err.Error())
+		}
+		if len(model.Coefficients) == 0 {
+			return nil, Errorf("Logistic regression has no coefficients")
+		}
+		return model, nil
+	case "DT":
+		var tree TreeNode
+		err := decoder.Decode(&tree)
+		if err != nil {
+			return nil, Errorf("Malformed decision tree: %s", err.Error())
+		}
+		err = validateTree(&tree, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &tree, nil
+	}
+	return nil, Errorf("Model type is not supported natively: %s", modelType)
+}
+
+func isNativeModel(model ModelFile) bool {
+	return model.LibraryType == nativeLibraryType
+}
+
+// evaluateNativeModel scores every row of the data, columns of DataFlex are features
+func evaluateNativeModel(model ModelFile, data DataFlex) ([]float64, error) {
+	nativeModel, err := parseNativeModel(model.ModelType, model.File)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.Data) < nativeModel.Features() {
+		return nil, Errorf("Model %s uses %d features, data %s has %d", model.Name, nativeModel.Features(), data.DataName, len(data.Data))
+	}
+	predictions := make([]float64, 0, len(data.Class))
+	row := make([]float64, len(data.Data))
+	for r := 0; r < len(data.Class); r++ {
+		for c := range data.Data {
+			row[c], err = strconv.ParseFloat(strings.TrimSpace(data.Data[c][r]), 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		predictions = append(predictions, nativeModel.Predict(row))
+	}
+	return predictions, nil
+}
+
+// checkNativeModel parses the definition and checks it against the features of the schema
+func checkNativeModel(stub shim.ChaincodeStubInterface, modelType string, definition string, schemaName string) error {
+	nativeModel, err := parseNativeModel(modelType, definition)
+	if err != nil {
+		return err
+	}
+	schema, err := getFeatureSchema(stub, schemaName)
+	if err != nil {
+		return err
+	}
+	// logistic regression needs a coefficient for every feature, a tree may leave trailing features unused
+	if _, ok := nativeModel.(LogisticModel); ok && nativeModel.Features() != len(schema.Features) {
+		return Errorf("Logistic regression has %d coefficients, schema %s has %d features", nativeModel.Features(), schemaName, len(schema.Features))
+	}
+	if nativeModel.Features() > len(schema.Features) {
+		return Errorf("Decision tree splits on feature %d, schema %s has %d features", nativeModel.Features()-1, schemaName, len(schema.Features))
+	}
+	return nil
+}
+
+// initNativeModel stores JSON definition of the model inline, it is checked against the feature schema on upload
+func (t *SimpleModel) initNativeModel(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	 0        1                                  2                              3
+	//   "LR", "", "{\"Intercept\":-1.2,\"Coefficients\":[0.4,2.1]}", "patients", "readmission"
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting model type, owner, model definition, feature schema and task")
+	}
+	modelType := args[0]
+	owner, err := resolveOwner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	definition := args[2]
+	schemaName := args[3]
+
+	err = checkNativeModel(stub, modelType, definition, schemaName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return putModelFile(stub, &ModelFile{"modelFile", "", definition, owner, modelType, nativeLibraryType, 0, sha256Hex([]byte(definition)), int64(len(definition)), "application/json", schemaName, "", 0, "", "", args[4]})
+}
+
+//Library adapters -----------------------------------------------------------------------------------------------
+
+// LibraryAdapter translates oracle calls for models of one library type,
+// a new library is supported by adding its adapter to libraryAdapters
+type LibraryAdapter interface {
+	// BuildUrl returns endpoint of the operation, "apiValidate" or "apiTest", on the oracle
+	BuildUrl(oracleUrl string, operation string, modelType string) string
+	EncodeRequest(payload FilePayload) ([]byte, error)
+	DecodePredictions(responseBytes []byte) ([]float64, error)
+	DecodeValidity(responseBytes []byte) (bool, error)
+}
+
+var libraryAdapters = map[string]LibraryAdapter{
+	"AS":   sparkAdapter{},
+	"MLR3": mlr3Adapter{},
+	"ONNX": portableAdapter{},
+	"PMML": portableAdapter{},
+	// results the worker submits for native models on private data
+	nativeLibraryType: portableAdapter{},
+}
+
+func getLibraryAdapter(libraryType string) (LibraryAdapter, error) {
+	adapter, ok := libraryAdapters[libraryType]
+	if !ok {
+		return nil, Errorf("Library type is not supported: %s", libraryType)
+	}
+	return adapter, nil
+}
+
+// Apache Spark oracle serves one endpoint per model type and answers with plain JSON
+type sparkAdapter struct{}
+
+func (sparkAdapter) BuildUrl(oracleUrl string, operation string, modelType string) string {
+	return oracleUrl + operation + modelType
+}
+
+func (sparkAdapter) EncodeRequest(payload FilePayload) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+func (sparkAdapter) DecodePredictions(responseBytes []byte) ([]float64, error) {
+	var results Results
+	err := json.Unmarshal(responseBytes, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results.ArrayOfResults, nil
+}
+
+func (sparkAdapter) DecodeValidity(responseBytes []byte) (bool, error) {
+	var validity ModelValidity
+	err := json.Unmarshal(responseBytes, &validity)
+	if err != nil {
+		return false, err
+	}
+	return validity.ModelValidity != 0, nil
+}
+
+// MLR3 oracle serves one endpoint for all model types, plumber may box its JSON answer into a string
+type mlr3Adapter struct{}
+
+func (mlr3Adapter) BuildUrl(oracleUrl string, operation string, modelType string) string {
+	return oracleUrl + operation
+}
+
+func (mlr3Adapter) EncodeRequest(payload FilePayload) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+// predictions come as [row, probability] pairs
+func (mlr3Adapter) DecodePredictions(responseBytes []byte) ([]float64, error) {
+	var pairs [][]json.Number
+	err := json.Unmarshal(unboxJSONString(responseBytes), &pairs)
+	if err != nil {
+		return nil, Errorf("Malformed MLR3 oracle response: %s", err.Error())
+	}
+	predictions := make([]float64, 0, len(pairs))
+	for i, pair := range pairs {
+		if len(pair) != 2 {
+			return nil, Errorf("Malformed MLR3 oracle response: prediction %d is not a row and probability pair", i)
+		}
+		probability, err := pair[1].Float64()
+		if err != nil {
+			return nil, Errorf("Malformed MLR3 oracle response: %s", err.Error())
+		}
+		predictions = append(predictions, probability)
+	}
+	return predictions, nil
+}
+
+func (mlr3Adapter) DecodeValidity(responseBytes []byte) (bool, error) {
+	var validity ModelValidity
+	err := json.Unmarshal(unboxJSONString(responseBytes), &validity)
+	if err != nil {
+		return false, err
+	}
+	return validity.ModelValidity != 0, nil
+}
+
+// portable model formats are served by one endpoint per operation answering with plain JSON,
+// PMML models are evaluated by the off-chain worker which submits its results in the same form
+type portableAdapter struct{}
+
+func (portableAdapter) BuildUrl(oracleUrl string, operation string, modelType string) string {
+	return oracleUrl + operation
+}
+
+func (portableAdapter) EncodeRequest(payload FilePayload) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+func (portableAdapter) DecodePredictions(responseBytes []byte) ([]float64, error) {
+	return sparkAdapter{}.DecodePredictions(responseBytes)
+}
+
+func (portableAdapter) DecodeValidity(responseBytes []byte) (bool, error) {
+	return sparkAdapter{}.DecodeValidity(responseBytes)
+}
+
+// unboxJSONString returns JSON document an oracle sent encoded as a JSON string, other responses are returned as they are
+func unboxJSONString(responseBytes []byte) []byte {
+	var boxed string
+	if json.Unmarshal(responseBytes, &boxed) == nil {
+		return []byte(boxed)
+	}
+	return responseBytes
+}
+
+//Methods for oracle registry ------------------------------------------------------------------------------------
+
+func oracleKey(libraryType string) string {
+	return "oracle" + libraryType
+}
+
+// getOracle returns the registered oracle for the library type if it is enabled
+func getOracle(stub shim.ChaincodeStubInterface, libraryType string) (OracleRegistry, error) {
+	var oracle OracleRegistry
+	oracleBytes, err := stub.GetState(oracleKey(libraryType))
+	if err != nil {
+		return oracle, err
+	} else if oracleBytes == nil {
+		return oracle, Errorf("No oracle registered for library type: %s", libraryType)
+	}
+	err = json.Unmarshal(oracleBytes, &oracle)
+	if err != nil {
+		return oracle, err
+	}
+	if !oracle.Enabled {
+		return oracle, Errorf("Oracle for library type %s is disabled", libraryType)
+	}
+	return oracle, nil
+}
+
+// getOracleUrl returns the registered endpoint of an enabled oracle for the library type ending with a slash
+func getOracleUrl(stub shim.ChaincodeStubInterface, libraryType string) (string, error) {
+	oracle, err := getOracle(stub, libraryType)
+	if err != nil {
+		return "", err
+	}
+	return oracle.Url, nil
+}
+
+func putOracle(stub shim.ChaincodeStubInterface, oracle *OracleRegistry) pb.Response {
+	oracleJSONasBytes, err := json.Marshal(oracle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(oracleKey(oracle.LibraryType), oracleJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+func normalizeOracleUrl(url string) string {
+	url = strings.TrimSpace(url)
+	if !strings.HasSuffix(url, "/") {
+		url = url + "/"
+	}
+	return url
+}
+
+func (t *SimpleModel) registerOracle(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0                   1                                   2
+	//   "AS", "http://192.168.144.2:8080/", "-----BEGIN PUBLIC KEY-----\n..."
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting library type, oracle url and oracle public key")
+	}
+	libraryType := args[0]
+	_, err := parseOraclePublicKey(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Check if oracle already exists ====
+	oracleAsBytes, err := stub.GetState(oracleKey(libraryType))
+	if err != nil {
+		return shim.Error("Failed to get oracle: " + err.Error())
+	} else if oracleAsBytes != nil {
+		return shim.Error("This oracle already exists: " + libraryType)
+	}
+
+	return putOracle(stub, &OracleRegistry{"oracleRegistry", libraryType, normalizeOracleUrl(args[1]), true, args[2]})
+}
+
+func (t *SimpleModel) updateOracle(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting library type, oracle url and oracle public key")
+	}
+	libraryType := args[0]
+	_, err := parseOraclePublicKey(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	oracleAsBytes, err := stub.GetState(oracleKey(libraryType))
+	if err != nil {
+		return shim.Error("Failed to get oracle: " + err.Error())
+	} else if oracleAsBytes == nil {
+		return shim.Error("Oracle does not exist: " + libraryType)
+	}
+
+	// updating an oracle enables it again
+	return putOracle(stub, &OracleRegistry{"oracleRegistry", libraryType, normalizeOracleUrl(args[1]), true, args[2]})
+}
+
+func (t *SimpleModel) disableOracle(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var oracle OracleRegistry
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting library type")
+	}
+	libraryType := args[0]
+
+	oracleAsBytes, err := stub.GetState(oracleKey(libraryType))
+	if err != nil {
+		return shim.Error("Failed to get oracle: " + err.Error())
+	} else if oracleAsBytes == nil {
+		return shim.Error("Oracle does not exist: " + libraryType)
+	}
+	err = json.Unmarshal(oracleAsBytes, &oracle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	oracle.Enabled = false
+	return putOracle(stub, &oracle)
+}
+
+func (t *SimpleModel) getAllOracles(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	queryString :="{\"selector\":{\"ObjectType\": \"oracleRegistry\"}}"
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+//Methods for feature schema registry ----------------------------------------------------------------------------
+
+// feature types a schema may declare, data cells of every type must be numeric
+var allowedFeatureTypes = []string{"numeric", "integer"}
+
+func featureSchemaKey(schemaName string) string {
+	return "schema" + schemaName
+}
+
+func getFeatureSchema(stub shim.ChaincodeStubInterface, schemaName string) (FeatureSchema, error) {
+	var schema FeatureSchema
+	schemaBytes, err := stub.GetState(featureSchemaKey(schemaName))
+	if err != nil {
+		return schema, err
+	} else if schemaBytes == nil {
+		return schema, Errorf("Feature schema does not exist: %s", schemaName)
+	}
+	err = json.Unmarshal(schemaBytes, &schema)
+	return schema, err
+}
+
+// parseSchemaFeatures reads features in order from "age:numeric,visits:integer"
+func parseSchemaFeatures(stringFeatures string) ([]SchemaFeature, error) {
+	var features []SchemaFeature
+	names := make(map[string]bool)
+	for _, feature := range strings.Split(stringFeatures, ",") {
+		nameAndType := strings.Split(strings.TrimSpace(feature), ":")
+		if len(nameAndType) != 2 || nameAndType[0] == "" {
+			return nil, Errorf("Feature must be given as name:type: %s", feature)
+		}
+		if names[nameAndType[0]] {
+			return nil, Errorf("Feature is declared twice: %s", nameAndType[0])
+		}
+		allowed := false
+		for _, featureType := range allowedFeatureTypes {
+			if nameAndType[1] == featureType {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return nil, Errorf("Feature %s has type %s, expecting one of %v", nameAndType[0], nameAndType[1], allowedFeatureTypes)
+		}
+		names[nameAndType[0]] = true
+		features = append(features, SchemaFeature{nameAndType[0], nameAndType[1]})
+	}
+	return features, nil
+}
+
+// validateDataSchema checks data has the columns of the schema and integer features hold whole numbers
+func validateDataSchema(data [][]string, schema FeatureSchema) error {
+	if len(data) != len(schema.Features) {
+		return &DataValidationError{"Columns", -1, -1, strconv.Itoa(len(data)), Sprintf("schema %s has %d features", schema.Name, len(schema.Features))}
+	}
+	for column, feature := range schema.Features {
+		if feature.Type != "integer" {
+			continue
+		}
+		for row, value := range data[column] {
+			_, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return &DataValidationError{"DataTable", row, column, value, "feature " + feature.Name + " is not an integer"}
+			}
+		}
+	}
+	return nil
+}
+
+func sameFeatures(first []SchemaFeature, second []SchemaFeature) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// featureSchemaCompatibility returns why the model can not be validated on the data, empty when it can
+func featureSchemaCompatibility(stub shim.ChaincodeStubInterface, model ModelFile, data DataFlex) (string, error) {
+	if model.SchemaName == "" {
+		return "Model " + model.Name + " does not reference a feature schema", nil
+	}
+	if data.SchemaName == "" {
+		return "Data " + data.DataName + " does not reference a feature schema", nil
+	}
+	if model.SchemaName == data.SchemaName {
+		return "", nil
+	}
+	modelSchema, err := getFeatureSchema(stub, model.SchemaName)
+	if err != nil {
+		return "", err
+	}
+	dataSchema, err := getFeatureSchema(stub, data.SchemaName)
+	if err != nil {
+		return "", err
+	}
+	// differently named schemas are compatible when they declare the same features in the same order
+	if !sameFeatures(modelSchema.Features, dataSchema.Features) {
+		return Sprintf("Model %s expects %d features of schema %s, data %s has %d features of schema %s",
+			model.Name, len(modelSchema.Features), modelSchema.Name, data.DataName, len(dataSchema.Features), dataSchema.Name), nil
+	}
+	return "", nil
+}
+
+func (t *SimpleModel) registerFeatureSchema(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0              1                     2
+	//   "patients", "", "age:numeric,visits:integer"
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting schema name, owner and features")
+	}
+	schemaName := args[0]
+	if schemaName == "" {
+		return shim.Error("Schema name must not be empty")
+	}
+	features, err := parseSchemaFeatures(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Check if schema already exists, schemas are never changed once models and data refer to them ====
+	schemaAsBytes, err := stub.GetState(featureSchemaKey(schemaName))
+	if err != nil {
+		return shim.Error("Failed to get feature schema: " + err.Error())
+	} else if schemaAsBytes != nil {
+		return shim.Error("This feature schema already exists: " + schemaName)
+	}
+
+	owner, err := resolveOwner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	schema := &FeatureSchema{"featureSchema", schemaName, features, owner}
+	schemaJSONasBytes, err := json.Marshal(schema)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(featureSchemaKey(schemaName), schemaJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+func (t *SimpleModel) getFeatureSchemaByName(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting schema name")
+	}
+	schemaAsBytes, err := stub.GetState(featureSchemaKey(args[0]))
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if schemaAsBytes == nil {
+		return shim.Error("Feature schema does not exist: " + args[0])
+	}
+	return shim.Success(schemaAsBytes)
+}
+
+func (t *SimpleModel) getAllFeatureSchemas(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	queryString :="{\"selector\":{\"ObjectType\": \"featureSchema\"}}"
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+//Methods for tasks ----------------------------------------------------------------------------------------------
+
+// evaluation metrics the results page can rank a task by
+var allowedTaskMetrics = []string{"AUC", "LogLoss"}
+
+// deadline layouts accepted by createTask, times without zone are UTC
+var taskDeadlineLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"}
+
+func taskKey(taskName string) string {
+	return "task" + taskName
+}
+
+func getTask(stub shim.ChaincodeStubInterface, taskName string) (Task, error) {
+	var task Task
+	taskBytes, err := stub.GetState(taskKey(taskName))
+	if err != nil {
+		return task, err
+	} else if taskBytes == nil {
+		return task, Errorf("Task does not exist: %s", taskName)
+	}
+	err = json.Unmarshal(taskBytes, &task)
+	return task, err
+}
+
+func parseTaskDeadline(stringDeadline string) (string, error) {
+	if stringDeadline == "" {
+		return "", nil
+	}
+	for _, layout := range taskDeadlineLayouts {
+		deadline, err := time.Parse(layout, stringDeadline)
+		if err == nil {
+			return deadline.UTC().Format(time.RFC3339), nil
+		}
+	}
+	return "", Errorf("Deadline is not a date or RFC 3339 time: %s", stringDeadline)
+}
+
+// checkTaskSubmission accepts models and data for the task until its deadline, models must be of a type the task allows,
+// assets without a task are pooled together as before tasks existed
+func checkTaskSubmission(stub shim.ChaincodeStubInterface, taskName string, modelType string) error {
+	if taskName == "" {
+		return nil
+	}
+	task, err := getTask(stub, taskName)
+	if err != nil {
+		return err
+	}
+	if task.Deadline != "" {
+		deadline, err := time.Parse(time.RFC3339, task.Deadline)
+		if err != nil {
+			return err
+		}
+		// transaction time is the same on every endorsing peer
+		txTimestamp, err := stub.GetTxTimestamp()
+		if err != nil {
+			return err
+		}
+		txTime, err := ptypes.Timestamp(txTimestamp)
+		if err != nil {
+			return err
+		}
+		if txTime.After(deadline) {
+			return Errorf("Task %s closed at %s", taskName, task.Deadline)
+		}
+	}
+	if modelType != "" && len(task.ModelTypes) > 0 && !containsString(task.ModelTypes, modelType) {
+		return Errorf("Task %s accepts model types %s, not %s", taskName, strings.Join(task.ModelTypes, ", "), modelType)
+	}
+	return nil
+}
+
+// checkTaskClassLabel accepts data for a task with a target label only when its class column is that label
+func checkTaskClassLabel(stub shim.ChaincodeStubInterface, taskName string, classLabel string) error {
+	if taskName == "" {
+		return nil
+	}
+	task, err := getTask(stub, taskName)
+	if err != nil {
+		return err
+	}
+	if task.TargetLabel != "" && classLabel != task.TargetLabel {
+		return Errorf("Task %s predicts %s, class column of the data is labelled %q", taskName, task.TargetLabel, classLabel)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *SimpleModel) createTask(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0                    1                        2          3        4          5
+	//   "readmission", "30 day readmission of patients", "readmitted", "LR,DT", "AUC", "2026-12-31"
+	if len(args) != 6 {
+		return shim.Error("Incorrect number of arguments. Expecting task name, description, target label, model types, metric and deadline")
+	}
+	taskName := args[0]
+	if taskName == "" {
+		return shim.Error("Task name must not be empty")
+	}
+	var modelTypes []string
+	for _, modelType := range strings.Split(args[3], ",") {
+		if modelType = strings.TrimSpace(modelType); modelType != "" {
+			modelTypes = append(modelTypes, modelType)
+		}
+	}
+	metric := args[4]
+	if !containsString(allowedTaskMetrics, metric) {
+		return shim.Error("Metric must be one of " + strings.Join(allowedTaskMetrics, ", ") + ": " + metric)
+	}
+	deadline, err := parseTaskDeadline(args[5])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	owner, err := submitterIdentity(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Check if task already exists ====
+	taskAsBytes, err := stub.GetState(taskKey(taskName))
+	if err != nil {
+		return shim.Error("Failed to get task: " + err.Error())
+	} else if taskAsBytes != nil {
+		return shim.Error("This task already exists: " + taskName)
+	}
+
+	task := &Task{"task", taskName, args[1], args[2], modelTypes, metric, deadline, owner}
+	taskJSONasBytes, err := json.Marshal(task)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(taskKey(taskName), taskJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+func (t *SimpleModel) getTaskByName(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting task name")
+	}
+	task, err := getTask(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	taskAsBytes, err := json.Marshal(task)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(taskAsBytes)
+}
+
+func (t *SimpleModel) getAllTasks(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	queryString :="{\"selector\":{\"ObjectType\": \"task\"}}"
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+//Methods for reward tokens --------------------------------------------------------------------------------------
+
+// balance of reward tokens held by one identity, stored under "tokenAccount" + owner
+type TokenAccount struct{
+	ObjectType string `json:"ObjectType"`
+	Owner string `json:"Owner"`
+	Balance uint64 `json:"Balance"`
+}
+
+type TokenAccountWrapper struct{
+	Key    string 	`json:"Key"`
+	Record TokenAccount 	`json:"Record"`
+}
+
+// Shapley values of one evaluation round keyed by model and data names
+// {"Models": {"Model0_v1": 0.12}, "Data": {"dataCol0": 0.05}}
+type RewardShares struct{
+	Models map[string]float64 `json:"Models"`
+	Data map[string]float64 `json:"Data"`
+}
+
+type RewardPayout struct{
+	Asset string `json:"Asset"`
+	Owner string `json:"Owner"`
+	Shapley float64 `json:"Shapley"`
+	Amount uint64 `json:"Amount"`
+}
+
+// distributed reward pool of an evaluation round, stored under "rewardRound" + round so a round is paid once
+type RewardRound struct{
+	ObjectType string `json:"ObjectType"`
+	Round string `json:"Round"`
+	Task string `json:"Task"`
+	Pool uint64 `json:"Pool"`
+	Distributor string `json:"Distributor"`
+	Payouts []RewardPayout `json:"Payouts"`
+	TxID string `json:"TxID"`
+}
+
+func tokenAccountKey(owner string) string {
+	return "tokenAccount" + owner
+}
+
+func getTokenAccount(stub shim.ChaincodeStubInterface, owner string) (*TokenAccount, error) {
+	account := &TokenAccount{"tokenAccount", owner, 0}
+	accountBytes, err := stub.GetState(tokenAccountKey(owner))
+	if err != nil {
+		return nil, err
+	}
+	if accountBytes != nil {
+		err = json.Unmarshal(accountBytes, account)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return account, nil
+}
+
+func putTokenAccount(stub shim.ChaincodeStubInterface, account *TokenAccount) error {
+	accountAsBytes, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(tokenAccountKey(account.Owner), accountAsBytes)
+}
+
+// tokenChanges sums credits and debits per account, GetState does not see writes of the running
+// transaction so every account touched by a transaction is read and written once by applyTokenChanges
+type tokenChanges map[string]*tokenChange
+
+type tokenChange struct{
+	Credit uint64
+	Debit uint64
+}
+
+func (changes tokenChanges) change(owner string) *tokenChange {
+	if changes[owner] == nil {
+		changes[owner] = &tokenChange{}
+	}
+	return changes[owner]
+}
+
+func (changes tokenChanges) credit(owner string, amount uint64) error {
+	change := changes.change(owner)
+	if change.Credit+amount < change.Credit {
+		return Errorf("Balance of %s would overflow", owner)
+	}
+	change.Credit += amount
+	return nil
+}
+
+func (changes tokenChanges) debit(owner string, amount uint64) error {
+	change := changes.change(owner)
+	if change.Debit+amount < change.Debit {
+		return Errorf("Debit of %s would overflow", owner)
+	}
+	change.Debit += amount
+	return nil
+}
+
+// applyTokenChanges updates accounts in sorted owner order so every peer writes the same set
+func applyTokenChanges(stub shim.ChaincodeStubInterface, changes tokenChanges) error {
+	owners := make([]string, 0, len(changes))
+	for owner := range changes {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	for _, owner := range owners {
+		change := changes[owner]
+		account, err := getTokenAccount(stub, owner)
+		if err != nil {
+			return err
+		}
+		if account.Balance+change.Credit < account.Balance {
+			return Errorf("Balance of %s would overflow", owner)
+		}
+		if account.Balance+change.Credit < change.Debit {
+			return Errorf("Balance of %s is %d, %d tokens are needed", owner, account.Balance, change.Debit-change.Credit)
+		}
+		account.Balance = account.Balance + change.Credit - change.Debit
+		err = putTokenAccount(stub, account)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseTokenAmount(stringAmount string) (uint64, error) {
+	amount, err := strconv.ParseUint(stringAmount, 10, 64)
+	if err != nil || amount == 0 {
+		return 0, Errorf("Token amount must be a positive integer: %s", stringAmount)
+	}
+	return amount, nil
+}
+
+func (t *SimpleModel) mintTokens(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0          1
+	//   "Org1MSP::User1@org1.example.com", "1000"
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting recipient and amount")
+	}
+	amount, err := parseTokenAmount(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	recipient, err := resolveOwner(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	changes := tokenChanges{}
+	err = changes.credit(recipient, amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = applyTokenChanges(stub, changes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+func (t *SimpleModel) transferTokens(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0          1
+	//   "Org2MSP::User1@org2.example.com", "25"
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting recipient and amount")
+	}
+	recipient := args[0]
+	if recipient == "" {
+		return shim.Error("Recipient must not be empty")
+	}
+	amount, err := parseTokenAmount(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sender, err := submitterIdentity(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if sender == recipient {
+		return shim.Error("Tokens can not be transferred to the sender")
+	}
+	changes := tokenChanges{}
+	err = changes.debit(sender, amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = changes.credit(recipient, amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = applyTokenChanges(stub, changes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// evaluatedAssets names models and data with results recorded in the task, the range read over all results
+// is checked again at commit so a round can only pay for evaluations on the ledger
+func evaluatedAssets(stub shim.ChaincodeStubInterface, taskName string) (map[string]bool, error) {
+	assets := make(map[string]bool)
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("results", []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var results ResultsArray
+		err = json.Unmarshal(queryResponse.Value, &results)
+		if err != nil {
+			return nil, err
+		}
+		if results.Task != taskName {
+			continue
+		}
+		assets[results.ModelName] = true
+		assets[results.DataColName] = true
+	}
+	return assets, nil
+}
+
+// rewardPayouts looks up owners of the rewarded assets, assets with Shapley value of zero or below get nothing
+func rewardPayouts(stub shim.ChaincodeStubInterface, shares RewardShares, evaluated map[string]bool) ([]RewardPayout, error) {
+	var payouts []RewardPayout
+	for _, assets := range []map[string]float64{shares.Models, shares.Data} {
+		names := make([]string, 0, len(assets))
+		for name := range assets {
+			names = append(names, name)
+		}
+		// map order differs between peers, payouts must not
+		sort.Strings(names)
+		for _, name := range names {
+			shapley := assets[name]
+			if math.IsNaN(shapley) || math.IsInf(shapley, 0) {
+				return nil, Errorf("Shapley value of %s is not a number", name)
+			}
+			if shapley <= 0 {
+				continue
+			}
+			if !evaluated[name] {
+				return nil, Errorf("No results of %s are recorded in this task", name)
+			}
+			var asset struct{
+				Owner string `json:"Owner"`
+			}
+			assetBytes, err := stub.GetState(name)
+			if err != nil {
+				return nil, err
+			} else if assetBytes == nil {
+				return nil, Errorf("Asset does not exist: %s", name)
+			}
+			err = json.Unmarshal(assetBytes, &asset)
+			if err != nil {
+				return nil, err
+			}
+			payouts = append(payouts, RewardPayout{name, asset.Owner, shapley, 0})
+		}
+	}
+	return payouts, nil
+}
+
+// splitRewardPool gives every payout its proportional share rounded down,
+// tokens left by rounding go to the largest remainders so the whole pool is paid
+func splitRewardPool(pool uint64, payouts []RewardPayout) {
+	var total float64
+	for _, payout := range payouts {
+		total += payout.Shapley
+	}
+	remainders := make([]float64, len(payouts))
+	var paid uint64
+	for i := range payouts {
+		exact := float64(pool) * (payouts[i].Shapley / total)
+		payouts[i].Amount = uint64(math.Floor(exact))
+		if payouts[i].Amount > pool-paid {
+			payouts[i].Amount = pool - paid
+		}
+		remainders[i] = exact - float64(payouts[i].Amount)
+		paid += payouts[i].Amount
+	}
+	order := make([]int, len(payouts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; paid < pool; i = (i + 1) % len(order) {
+		payouts[order[i]].Amount++
+		paid++
+	}
+}
+
+// distributeRewards pays the pool from the balance of the submitter to owners of models and data
+// in proportion to their Shapley values in the evaluation round of a task, empty task is the round of assets without one
+func (t *SimpleModel) distributeRewards(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0          1                                2                                            3
+	//   "round-3",  "1000", "{\"Models\":{\"Model0_v1\":0.12},\"Data\":{\"dataCol0\":0.05}}", "readmission"
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting round, pool, Shapley values and task")
+	}
+	taskName := args[3]
+	round := args[0]
+	if round == "" {
+		return shim.Error("Round must not be empty")
+	}
+	pool, err := parseTokenAmount(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var shares RewardShares
+	err = json.Unmarshal([]byte(args[2]), &shares)
+	if err != nil {
+		return shim.Error("Shapley values are not valid JSON: " + err.Error())
+	}
+
+	// ==== Check if round was already paid ====
+	roundAsBytes, err := stub.GetState("rewardRound" + round)
+	if err != nil {
+		return shim.Error("Failed to get reward round: " + err.Error())
+	} else if roundAsBytes != nil {
+		return shim.Error("This reward round was already distributed: " + round)
+	}
+
+	evaluated, err := evaluatedAssets(stub, taskName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	payouts, err := rewardPayouts(stub, shares, evaluated)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(payouts) == 0 {
+		return shim.Error("No model or data has a positive Shapley value in round " + round)
+	}
+	splitRewardPool(pool, payouts)
+
+	distributor, err := submitterIdentity(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// an owner of several assets, or a distributor owning an asset, gets one summed update
+	changes := tokenChanges{}
+	err = changes.debit(distributor, pool)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, payout := range payouts {
+		err = changes.credit(payout.Owner, payout.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	err = applyTokenChanges(stub, changes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	rewardRound := &RewardRound{"rewardRound", round, taskName, pool, distributor, payouts, stub.GetTxID()}
+	rewardRoundAsBytes, err := json.Marshal(rewardRound)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState("rewardRound"+round, rewardRoundAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(rewardRoundAsBytes)
+}
+
+// owner argument is optional, without it the balance of the submitter is returned
+func (t *SimpleModel) getTokenBalance(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	owner := ""
+	if len(args) > 0 {
+		owner = args[0]
+	}
+	var err error
+	if owner == "" {
+		owner, err = submitterIdentity(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	account, err := getTokenAccount(stub, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	accountAsBytes, err := json.Marshal(account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(accountAsBytes)
+}
+
+func (t *SimpleModel) getAllTokenAccounts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	queryString :="{\"selector\":{\"ObjectType\": \"tokenAccount\"}}"
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+func (t *SimpleModel) getAllRewardRounds(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	queryString :="{\"selector\":{\"ObjectType\": \"rewardRound\"}}"
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+//Methods for client identity ------------------------------------------------------------------------------------
+
+// submitterIdentity names the submitting client as "Org1MSP::User1@org1.example.com" from its MSP ID and certificate subject
+func submitterIdentity(stub shim.ChaincodeStubInterface) (string, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", err
+	}
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		return "", err
+	}
+	return mspID + "::" + cert.Subject.CommonName, nil
+}
+
+// isAdmin is true for identities enrolled with admin in their role attribute or issued under the admin organizational unit
+func isAdmin(stub shim.ChaincodeStubInterface) (bool, error) {
+	roles, err := submitterRoles(stub)
+	if err != nil {
+		return false, err
+	}
+	if hasAnyRole(roles, []string{roleAdmin}) {
+		return true, nil
+	}
+	cert, err := cid.GetX509Certificate(stub)
+	if err != nil {
+		return false, err
+	}
+	for _, unit := range cert.Subject.OrganizationalUnit {
+		if unit == "admin" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// roles are given by the "role" certificate attribute, identities with several roles list them as "modelProvider,evaluator"
+const (
+	roleAdmin = "admin"
+	roleModelProvider = "modelProvider"
+	roleDataProvider = "dataProvider"
+	roleEvaluator = "evaluator"
+	roleAuditor = "auditor"
+)
+
+// error messages of rejected calls start with this so clients can tell them from failed transactions
+const accessDeniedPrefix = "Access denied"
+
+var anyRole = []string{roleModelProvider, roleDataProvider, roleEvaluator, roleAuditor}
+
+// roles allowed to call each function, admins may call all of them and functions missing here are refused
+var functionRoles = map[string][]string{
+	"initModel": {roleModelProvider},
+	"initModelFile": {roleModelProvider},
+	"initNativeModel": {roleModelProvider},
+	"publishModelVersion": {roleModelProvider},
+	"publishNativeModelVersion": {roleModelProvider},
+	"setDefaultModelVersion": {roleModelProvider},
+	"testModelFile": {roleModelProvider},
+	"initDataFile": {roleDataProvider},
+	"initFlexData": {roleDataProvider},
+	"initPrivateFlexData": {roleDataProvider},
+	"registerFeatureSchema": {roleModelProvider, roleDataProvider},
+	"insertedModelFile": {roleEvaluator},
+	"insertedDataFile": {roleEvaluator},
+	"validateModel": {roleEvaluator},
+	"validateModelFileAPI": {roleEvaluator},
+	"updateAllModels": {roleEvaluator},
+	"updateAllModelsAPI": {roleEvaluator},
+	"submitValidationResult": {roleEvaluator},
+	"EvaluateNativeModel": {roleEvaluator},
+	"GetPendingValidations": {roleEvaluator},
+	"testConnection": {roleEvaluator},
+	"GetHistoryForKey": {roleAuditor},
+	"readModel": anyRole,
+	"GetModelID": anyRole,
+	"GetDataID": anyRole,
+	"GetAllModels": anyRole,
+	"GetAllData": anyRole,
+	"GetAllResults": anyRole,
+	"GetModelVersions": anyRole,
+	"GetAllModelLineages": anyRole,
+	"ReadData": anyRole,
+	"queryDataByOwner": anyRole,
+	"GetAllOracles": anyRole,
+	"GetFeatureSchema": anyRole,
+	"GetAllFeatureSchemas": anyRole,
+	"GetSkippedValidations": anyRole,
+	"transferTokens": anyRole,
+	"distributeRewards": {roleEvaluator},
+	"GetTokenBalance": anyRole,
+	"GetAllTokenAccounts": anyRole,
+	"GetAllRewardRounds": anyRole,
+	"createTask": {roleEvaluator},
+	"GetTask": anyRole,
+	"GetAllTasks": anyRole,
+}
+
+func submitterRoles(stub shim.ChaincodeStubInterface) ([]string, error) {
+	value, found, err := cid.GetAttributeValue(stub, "role")
+	if err != nil || !found {
+		return nil, err
+	}
+	var roles []string
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func hasAnyRole(roles []string, allowed []string) bool {
+	for _, role := range roles {
+		for _, allowedRole := range allowed {
+			if role == allowedRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorize checks roles of the submitter before the function runs
+func authorize(stub shim.ChaincodeStubInterface, function string) error {
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return err
+	}
+	if admin {
+		return nil
+	}
+	allowed, ok := functionRoles[function]
+	if !ok {
+		return Errorf("%s: %s is only available to %s", accessDeniedPrefix, function, roleAdmin)
+	}
+	roles, err := submitterRoles(stub)
+	if err != nil {
+		return err
+	}
+	if !hasAnyRole(roles, allowed) {
+		identity, err := submitterIdentity(stub)
+		if err != nil {
+			return err
+		}
+		return Errorf("%s: %s requires role %s, identity %s has roles [%s]", accessDeniedPrefix, function, strings.Join(allowed, " or "), identity, strings.Join(roles, ","))
+	}
+	return nil
+}
+
+// resolveOwner returns the owner assets are stored or looked up under, empty requested owner means the submitter,
+// only admins may name another owner
+func resolveOwner(stub shim.ChaincodeStubInterface, requested string) (string, error) {
+	identity, err := submitterIdentity(stub)
+	if err != nil {
+		return "", err
+	}
+	if requested == "" || requested == identity {
+		return identity, nil
+	}
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return "", err
+	}
+	if !admin {
+		return "", Errorf("Identity %s is not allowed to act for owner %s", identity, requested)
+	}
+	return requested, nil
+}
+
+//Methods for lifecycle events ------------------------------------------------------------------------------------
+
+// eventBatchingStub collects events of a transaction, Fabric keeps only the last SetEvent call
+type eventBatchingStub struct {
+	shim.ChaincodeStubInterface
+	name string
+	payloads []json.RawMessage
+}
+
+func (s *eventBatchingStub) SetEvent(name string, payload []byte) error {
+	if !json.Valid(payload) {
+		return Errorf("Event %s payload is not JSON", name)
+	}
+	if len(s.payloads) == 0 {
+		s.name = name
+	}
+	s.payloads = append(s.payloads, json.RawMessage(payload))
+	return nil
+}
+
+func (s *eventBatchingStub) flushEvents() error {
+	if len(s.payloads) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(s.payloads)
+	if err != nil {
+		return err
+	}
+	return s.ChaincodeStubInterface.SetEvent(s.name, payload)
+}
+
+func emitLifecycleEvent(stub shim.ChaincodeStubInterface, event LifecycleEvent) error {
+	event.TxID = stub.GetTxID()
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(event.Type, eventAsBytes)
+}
+
+//Methods for asset history ------------------------------------------------------------------------------------
+
+// creatorRecordingStub writes the MSP of the submitter to a companion key next to every state write,
+// the history of the companion key tells who made each modification of the asset key
+type creatorRecordingStub struct {
+	shim.ChaincodeStubInterface
+	mspID string
+}
+
+func (s *creatorRecordingStub) PutState(key string, value []byte) error {
+	err := s.ChaincodeStubInterface.PutState(key, value)
+	if err != nil {
+		return err
+	}
+	return s.recordCreator(key)
+}
+
+func (s *creatorRecordingStub) DelState(key string) error {
+	err := s.ChaincodeStubInterface.DelState(key)
+	if err != nil {
+		return err
+	}
+	return s.recordCreator(key)
+}
+
+func (s *creatorRecordingStub) recordCreator(key string) error {
+	if s.mspID == "" {
+		mspID, err := cid.GetMSPID(s.ChaincodeStubInterface)
+		if err != nil {
+			return err
+		}
+		s.mspID = mspID
+	}
+	creatorKey, err := creatorKey(s.ChaincodeStubInterface, key)
+	if err != nil {
+		return err
+	}
+	return s.ChaincodeStubInterface.PutState(creatorKey, []byte(s.mspID))
+}
+
+// creatorKey is the companion key of an asset key, result keys are composite keys themselves so the key is hex encoded
+func creatorKey(stub shim.ChaincodeStubInterface, key string) (string, error) {
+	return stub.CreateCompositeKey("creator", []string{hex.EncodeToString([]byte(key))})
+}
+
+// keyCreators maps the transactions that modified the key to the MSP of their submitter
+func keyCreators(stub shim.ChaincodeStubInterface, key string) (map[string]string, error) {
+	creatorKey, err := creatorKey(stub, key)
+	if err != nil {
+		return nil, err
+	}
+	historyIterator, err := stub.GetHistoryForKey(creatorKey)
+	if err != nil {
+		return nil, err
+	}
+	defer historyIterator.Close()
+
+	creators := map[string]string{}
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !modification.IsDelete {
+			creators[modification.TxId] = string(modification.Value)
+		}
+	}
+	return creators, nil
+}
+
+// getHistoryForKey returns modifications of the key from the oldest, result keys are composite keys as listed by GetAllResults
+func (t *SimpleModel) getHistoryForKey(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting key")
+	}
+	creators, err := keyCreators(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	historyIterator, err := stub.GetHistoryForKey(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer historyIterator.Close()
+
+	history := []HistoryEntry{}
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		entry := HistoryEntry{TxID: modification.TxId, CreatorMSP: creators[modification.TxId], IsDelete: modification.IsDelete, Value: json.RawMessage("null")}
+		if modification.Timestamp != nil {
+			timestamp, err := ptypes.Timestamp(modification.Timestamp)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			entry.Timestamp = timestamp.Format(time.RFC3339Nano)
+		}
+		// counters and other plain values are returned as JSON strings
+		if !modification.IsDelete {
+			if json.Valid(modification.Value) {
+				entry.Value = json.RawMessage(modification.Value)
+			} else {
+				entry.Value, err = json.Marshal(string(modification.Value))
+				if err != nil {
+					return shim.Error(err.Error())
+				}
+			}
+		}
+		history = append(history, entry)
+	}
+
+	historyAsBytes, err := json.Marshal(history)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(historyAsBytes)
+}
+
+//Methods to read data form Blockchain ------------------------------------------------------------------------
+
+func (t *SimpleModel) queryDataByOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+
+	if len(args) < 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	owner := args[0]
+
+	queryString := Sprintf("{\"selector\":{\"ObjectType\": \"data\",\"Owner\": \"%s\"}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}", owner)
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+func (t *SimpleModel) readModel(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var name, jsonResp string
+	var err error
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting name of the marble to query")
+	}
+
+	name = args[0]
+	valAsbytes, err := stub.GetState(name) //read model from chaincode state
+	if err != nil {
+		jsonResp = "{\"Error\":\"Failed to get state for " + name + "\"}"
+		return shim.Error(jsonResp)
+	} else if valAsbytes == nil {
+		jsonResp = "{\"Error\":\"Model does not exist: " + name + "\"}"
+		return shim.Error(jsonResp)
+	}
+	return shim.Success(valAsbytes)
+}
+
+// ID getting method is performance heavy, bet view creation from chaincode is hard so for the sake of the prototype its implemented by reading all entries and geeting the last one's ID
+// owner argument is optional, without it models of the submitter are counted
+func (t *SimpleModel) GetModelID(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	requestedOwner := ""
+	if len(args) > 0 {
+		requestedOwner = args[0]
+	}
+	modelOwner, err := resolveOwner(stub, requestedOwner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	responseBytes := make([]byte, 64)
+	var wrappedModel []ModelWrapper
+	queryString := Sprintf("{\"selector\":{\"ObjectType\": \"modelFile\",\"Owner\": %q}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}", modelOwner)
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = json.Unmarshal(queryResults, &wrappedModel)
 	if err != nil {
 		return shim.Error(err.Error())
 	}else{
@@ -678,12 +2801,19 @@ func (t *SimpleModel) GetModelID(stub shim.ChaincodeStubInterface, args []string
 	return shim.Success(responseBytes)
 }
 
+// owner argument is optional, without it data of the submitter is counted
 func (t *SimpleModel) GetDataID(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var err error
-	dataOwner:= args[0]
+	requestedOwner := ""
+	if len(args) > 0 {
+		requestedOwner = args[0]
+	}
+	dataOwner, err := resolveOwner(stub, requestedOwner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	responseBytes := make([]byte, 64)
 	var wrappedData[]DataColWrapper
-	queryString := Sprintf("{\"selector\":{\"ObjectType\": \"dataColumns\",\"Owner\": \"%s\"}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}", dataOwner)
+	queryString := Sprintf("{\"selector\":{\"ObjectType\": \"dataColumns\",\"Owner\": %q}, \"use_index\": [\"indexOwnerDoc\",\"indexOwner\"]}", dataOwner)
 	queryResults, err := getQueryResultForQueryString(stub, queryString)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -700,6 +2830,28 @@ func (t *SimpleModel) GetDataID(stub shim.ChaincodeStubInterface, args []string)
 
 //Methods to put data into Blockchain state DB -------------------------------------------------------------------------
 
+// nextAssetID reads and increments the ID counter of the object type, concurrent transactions
+// reading the same counter conflict on commit so only one of them gets the ID
+func nextAssetID(stub shim.ChaincodeStubInterface, objectType string) (uint64, error) {
+	var ID uint64
+	counterKey := "idCounter" + objectType
+	counterBytes, err := stub.GetState(counterKey)
+	if err != nil {
+		return 0, err
+	}
+	if counterBytes != nil {
+		ID, err = strconv.ParseUint(string(counterBytes), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = stub.PutState(counterKey, []byte(strconv.FormatUint(ID+1, 10)))
+	if err != nil {
+		return 0, err
+	}
+	return ID, nil
+}
+
 /*func (t *SimpleModel) initTestData(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 
 	owner := args[0]
@@ -738,92 +2890,435 @@ func (t *SimpleModel) GetDataID(stub shim.ChaincodeStubInterface, args []string)
 
 	for i := 0; i < len(data); i++ {
 
-		Xfloat, err := strconv.ParseFloat(data[i].Record.XData, 64)
+		Xfloat, err := strconv.ParseFloat(data[i].Record.XData, 64)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		Xrounded := Round(Xfloat,5.0)
+		XroundedString := Sprintf("%0.5f", Xrounded)
+
+		Yfloat, err := strconv.ParseFloat(data[i].Record.YData, 64)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		Yrounded := Round(Yfloat,5.0)
+		YroundedString := Sprintf("%0.5f", Yrounded)
+
+		sliceX = append(sliceX, XroundedString)
+		sliceY = append(sliceY, YroundedString)
+		sliceRes = append(sliceRes, data[i].Record.Class)
+	}
+
+	currentModelData := &DataCol{objectType,sliceX,sliceY,sliceRes,owner, "DataCol0", ID}
+	DataJSONasBytes, err := json.Marshal(currentModelData)
+
+	err = stub.PutState(args[1], DataJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}*/
+
+func stringToDataMatrix(dataString string) [][]string{
+	var dataMatrix [][]string
+	dataRow := strings.Split(dataString, ">")
+	for _, row := range dataRow {
+		var tempRow []string
+		dataCell := strings.Split(row, ",")
+		for _, cell := range dataCell {
+			tempRow = append(tempRow, cell)
+		}
+		dataMatrix = append(dataMatrix,  tempRow)
+	}
+	return dataMatrix
+}
+
+// class labels accepted in data, models are validated as binary classifiers
+var allowedClassLabels = []float64{0, 1}
+
+func (e *DataValidationError) Error() string {
+	errorAsBytes, err := json.Marshal(e)
+	if err != nil {
+		return e.Reason
+	}
+	return string(errorAsBytes)
+}
+
+// validateDataTable checks data is a numeric matrix with the declared number of feature columns,
+// each holding one value per class label, and that labels are in the allowed set
+func validateDataTable(data [][]string, class []string, columns int) error {
+	if columns < 1 {
+		return &DataValidationError{"Columns", -1, -1, strconv.Itoa(columns), "declared column count must be positive"}
+	}
+	if len(data) != columns {
+		return &DataValidationError{"DataTable", -1, -1, strconv.Itoa(len(data)), Sprintf("expected %d columns", columns)}
+	}
+	if len(class) == 0 || (len(class) == 1 && class[0] == "") {
+		return &DataValidationError{"Class", -1, -1, "", "no class labels"}
+	}
+	for column, values := range data {
+		if len(values) != len(class) {
+			// first row that is missing or extra
+			row := len(values)
+			if row > len(class) {
+				row = len(class)
+			}
+			return &DataValidationError{"DataTable", row, column, "", Sprintf("column has %d rows, expected %d rows as class labels", len(values), len(class))}
+		}
+		for row, value := range values {
+			n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+				return &DataValidationError{"DataTable", row, column, value, "not a number"}
+			}
+		}
+	}
+	for row, label := range class {
+		n, err := strconv.ParseFloat(strings.TrimSpace(label), 64)
+		allowed := false
+		for _, allowedLabel := range allowedClassLabels {
+			if err == nil && n == allowedLabel {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return &DataValidationError{"Class", row, -1, label, Sprintf("label is not one of %v", allowedClassLabels)}
+		}
+	}
+	return nil
+}
+
+// initFlexData allocates the next data ID and returns the key the data was stored under
+func (t *SimpleModel) initFlexData(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0             1              2      3        4            5              6
+	//   "", "1.1,2.3>1.4,2.1", "0,1",  "2", "patients", "readmission", "readmitted"
+	if len(args) != 7 {
+		return shim.Error("Incorrect number of arguments. Expecting owner, data, class, column count, feature schema, task and class label")
+	}
+	return putFlexData(stub, args[0], args[1], args[2], args[3], args[4], args[5], args[6], false)
+}
+
+// initPrivateFlexData stores data and class passed in the transient map to the private data collection,
+// public state only gets the hash and schema of the data
+func (t *SimpleModel) initPrivateFlexData(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0       1        2            3              4          transient: "DataTable"            "Class"
+	//       "",      "2", "patients", "readmission", "readmitted"               "1.1,2.3>1.4,2.1"        "0,1"
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting owner, column count, feature schema, task and class label, data and class are passed in transient map")
+	}
+	transientMap, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("Failed to get transient map: " + err.Error())
+	}
+	stringData, ok := transientMap["DataTable"]
+	if !ok || len(stringData) == 0 {
+		return shim.Error("DataTable must be passed in transient map")
+	}
+	stringClass, ok := transientMap["Class"]
+	if !ok || len(stringClass) == 0 {
+		return shim.Error("Class must be passed in transient map")
+	}
+	return putFlexData(stub, args[0], string(stringData), string(stringClass), args[1], args[2], args[3], args[4], true)
+}
+
+func putFlexData(stub shim.ChaincodeStubInterface, owner string, stringData string, stringClass string, stringColumns string, schemaName string, taskName string, classLabel string, private bool) pb.Response {
+	var data [][]string
+	data = stringToDataMatrix(stringData)
+
+	class := strings.Split(stringClass, ",")
+
+	columns, err := strconv.Atoi(stringColumns)
+	if err != nil {
+		return shim.Error((&DataValidationError{"Columns", -1, -1, stringColumns, "declared column count is not an integer"}).Error())
+	}
+	err = validateDataTable(data, class, columns)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	schema, err := getFeatureSchema(stub, schemaName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = validateDataSchema(data, schema)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	owner, err = resolveOwner(stub, owner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTaskSubmission(stub, taskName, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTaskClassLabel(stub, taskName, classLabel)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	objectType := "dataColumns"
+
+	ID, err := nextAssetID(stub, objectType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	batchName := "dataCol" + strconv.FormatUint(ID, 10)
+
+	// ==== Check if data already exists ====
+	dataAsBytes, err := stub.GetState(batchName)
+	if err != nil {
+		return shim.Error("Failed to get data: " + err.Error())
+	} else if dataAsBytes != nil {
+		return shim.Error("This data already exists: " + batchName)
+	}
+
+	currentModelData := &DataFlex{objectType,data,class,owner, batchName,ID,"",private,len(class),len(data),schemaName,taskName,classLabel,""}
+	currentModelData.Hash, err = dataFlexHash(*currentModelData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if private {
+		// raw table is only kept by peers of the contributing organisation
+		mspID, err := cid.GetMSPID(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		currentModelData.Collection = dataCollectionPrefix + mspID
+		privateAsBytes, err := json.Marshal(currentModelData)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.PutPrivateData(currentModelData.Collection, batchName, privateAsBytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		// ==== Only hash and schema go to public state ====
+		currentModelData.Data = nil
+		currentModelData.Class = nil
+	}
+
+	DataJSONasBytes, err := json.Marshal(currentModelData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = stub.PutState(batchName, DataJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = emitLifecycleEvent(stub, LifecycleEvent{Type: eventDatasetRegistered, Data: batchName, Owner: owner})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte(batchName))
+}
+
+// getDataFlex reads data from public state, private data only has its hash and schema there,
+// its table is read by ReadData and EvaluateNativeModel which are not endorsed by peers of every organisation
+func getDataFlex(stub shim.ChaincodeStubInterface, dataName string) (DataFlex, error) {
+	var data DataFlex
+	dataBytes, err := stub.GetState(dataName)
+	if err != nil {
+		return data, err
+	} else if dataBytes == nil {
+		return data, Errorf("Data does not exist: %s", dataName)
+	}
+	err = json.Unmarshal(dataBytes, &data)
+	return data, err
+}
+
+// resolvePrivateData reads private copy of the data, it is only available on peers of the organisation that contributed it
+func resolvePrivateData(stub shim.ChaincodeStubInterface, data DataFlex) (DataFlex, error) {
+	var privateData DataFlex
+	privateBytes, err := stub.GetPrivateData(data.Collection, data.DataName)
+	if err != nil || privateBytes == nil {
+		return data, Errorf("Not authorised to read private data: %s", data.DataName)
+	}
+	err = json.Unmarshal(privateBytes, &privateData)
+	if err != nil {
+		return data, err
+	}
+	privateHash, err := dataFlexHash(DataFlex{Data: privateData.Data, Class: privateData.Class})
+	if err != nil {
+		return data, err
+	}
+	if privateHash != data.Hash {
+		return data, Errorf("Private data does not match its public hash: %s", data.DataName)
+	}
+	return privateData, nil
+}
+
+// number of rows, public record of private data only has them in its schema
+func dataRows(data DataFlex) int {
+	if data.Private {
+		return data.Rows
+	}
+	return len(data.Class)
+}
+
+// canReadPrivateData lets the owner of private data, admins and evaluators of the organisation holding
+// its collection see its table, the collection is not readable by clients of other organisations
+func canReadPrivateData(stub shim.ChaincodeStubInterface, data DataFlex) (bool, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return false, err
+	}
+	if data.Collection != dataCollectionPrefix + mspID {
+		return false, nil
+	}
+	identity, err := submitterIdentity(stub)
+	if err != nil {
+		return false, err
+	}
+	if identity == data.Owner {
+		return true, nil
+	}
+	admin, err := isAdmin(stub)
+	if err != nil || admin {
+		return admin, err
+	}
+	roles, err := submitterRoles(stub)
+	if err != nil {
+		return false, err
+	}
+	return hasAnyRole(roles, []string{roleEvaluator}), nil
+}
+
+// readData returns the table of private data only to identities allowed by canReadPrivateData,
+// others get the public record with its hash and schema
+func (t *SimpleModel) readData(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting name of the data to query")
+	}
+	data, err := getDataFlex(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if data.Private {
+		allowed, err := canReadPrivateData(stub, data)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if allowed {
+			data, err = resolvePrivateData(stub, data)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+	dataAsBytes, err := json.Marshal(data)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(dataAsBytes)
+}
+
+// evaluateNativeModelQuery scores data with a native model for the off-chain worker, which submits the results
+// as {"Results": [...]} signed like an oracle, private data is only evaluated on peers holding its collection
+func (t *SimpleModel) evaluateNativeModelQuery(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0          1
+	//   "Model0_v1", "dataCol0"
+	var model ModelFile
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting model name and data name")
+	}
+	modelBytes, err := stub.GetState(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if modelBytes == nil {
+		return shim.Error("Model does not exist: " + args[0])
+	}
+	err = json.Unmarshal(modelBytes, &model)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isNativeModel(model) {
+		return shim.Error("Model is not evaluated natively: " + args[0])
+	}
+	data, err := getDataFlex(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if data.Private {
+		allowed, err := canReadPrivateData(stub, data)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		Xrounded := Round(Xfloat,5.0)
-		XroundedString := Sprintf("%0.5f", Xrounded)
-
-		Yfloat, err := strconv.ParseFloat(data[i].Record.YData, 64)
+		if !allowed {
+			return shim.Error(Sprintf("%s: private data %s is not readable by the submitter", accessDeniedPrefix, data.DataName))
+		}
+		data, err = resolvePrivateData(stub, data)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		Yrounded := Round(Yfloat,5.0)
-		YroundedString := Sprintf("%0.5f", Yrounded)
-
-		sliceX = append(sliceX, XroundedString)
-		sliceY = append(sliceY, YroundedString)
-		sliceRes = append(sliceRes, data[i].Record.Class)
 	}
-
-	currentModelData := &DataCol{objectType,sliceX,sliceY,sliceRes,owner, "DataCol0", ID}
-	DataJSONasBytes, err := json.Marshal(currentModelData)
-
-	err = stub.PutState(args[1], DataJSONasBytes)
+	predictions, err := evaluateNativeModel(model, data)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	responseAsBytes, err := json.Marshal(struct{
+		Results []float64 `json:"Results"`
+	}{predictions})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	return shim.Success(responseAsBytes)
+}
 
-	return shim.Success(nil)
-}*/
+// initResults stores results under composite key of model, data and transaction, so a pair validated again
+// replaces its earlier results on every peer alike
+func (t *SimpleModel) initResults(stub shim.ChaincodeStubInterface, args []string, modelName string, dataName string, results []float64) pb.Response {
 
-func stringToDataMatrix(dataString string) [][]string{
-	var dataMatrix [][]string
-	dataRow := strings.Split(dataString, ">")
-	for _, row := range dataRow {
-		var tempRow []string
-		dataCell := strings.Split(row, ",")
-		for _, cell := range dataCell {
-			tempRow = append(tempRow, cell)
+	// results say which version of the model they refer to, models stored before versioning have version 0
+	var model ModelFile
+	modelBytes, err := stub.GetState(modelName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if modelBytes != nil {
+		err = json.Unmarshal(modelBytes, &model)
+		if err != nil {
+			return shim.Error(err.Error())
 		}
-		dataMatrix = append(dataMatrix,  tempRow)
 	}
-	return dataMatrix
-}
 
-func (t *SimpleModel) initFlexData(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	batchName := args[0]
-	owner := args[1]
-	ID, err := strconv.ParseUint(args[2], 10, 64)
+	currentResults :=  &ResultsArray{ "results", results, modelName, dataName, stub.GetTxID(), model.Version, model.Task}
+	resultsAsBytes, err := json.Marshal(currentResults)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	stringData := args[3]
-	var data [][]string
-	data = stringToDataMatrix(stringData)
-
-	class := strings.Split(args[4], ",")
-
-	objectType := "dataColumns"
 
-	currentModelData := &DataFlex{objectType,data,class,owner, batchName,ID}
-	DataJSONasBytes, err := json.Marshal(currentModelData)
-
-	err = stub.PutState(batchName, DataJSONasBytes)
+	// ==== Remove earlier results of the same model and data ====
+	previousIterator, err := stub.GetStateByPartialCompositeKey("results", []string{modelName, dataName})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	defer previousIterator.Close()
+	for previousIterator.HasNext() {
+		previous, err := previousIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = stub.DelState(previous.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 
-	return shim.Success(nil)
-}
-
-func (t *SimpleModel) initResults(stub shim.ChaincodeStubInterface, args []string, modelName string, dataName string, results []float64) pb.Response {
-
-	//currentResults :=  &ResultsArray{ resIdCounter, results, modelName}
-	currentResults :=  &ResultsArray{ "results",0, results, modelName, dataName}
-	resultsAsBytes, err := json.Marshal(currentResults)
+	finalKey, err := stub.CreateCompositeKey("results", []string{modelName, dataName, stub.GetTxID()})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	key :=  strconv.FormatInt(resIdCounter, 10)
-	finalKey := "results" + key
 	err = stub.PutState(finalKey, resultsAsBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	resIdCounter++
+	err = emitLifecycleEvent(stub, LifecycleEvent{Type: eventResultsRecorded, Model: modelName, Data: dataName})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
@@ -884,59 +3379,322 @@ func (t *SimpleModel) initModel(stub shim.ChaincodeStubInterface, args []string)
 }
 
 
+// initModelFile allocates the next model ID and returns the key its first version was stored under,
+// model file itself stays in the blob store and only its SHA-256 hash, size and media type are recorded
 func (t *SimpleModel) initModelFile(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-
-	modelName := args[0]
-	modelType := args[1]
-	libraryType :=  args[2]
-	owner := args[3]
-	ID, err := strconv.ParseUint(args[4], 10, 64)
+	//   	 0     1        2          3        4            5               6            7
+	//   "DT", "AS", "", sha256Hex, "20480", "application/zip", "patients", "readmission"
+	if len(args) != 8 {
+		return shim.Error("Incorrect number of arguments. Expecting model type, library type, owner, file hash, file size, media type, feature schema and task")
+	}
+	modelType := args[0]
+	libraryType :=  args[1]
+	owner, err := resolveOwner(stub, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fileHash := strings.ToLower(args[3])
+	size, err := strconv.ParseInt(args[4], 10, 64)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mediaType := args[5]
+	schemaName := args[6]
 	objectType := "modelFile"
 
+	_, err = getFeatureSchema(stub, schemaName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-		model := &ModelFile{objectType, modelName,args[5],owner, modelType, libraryType,ID}
-		modelJSONasBytes, err := json.Marshal(model)
+	hashBytes, err := hex.DecodeString(fileHash)
+	if err != nil || len(hashBytes) != sha256.Size {
+		return shim.Error("Model file hash is not a SHA-256 hex digest: " + args[3])
+	}
 
-		// ==== Check if model already exists ====
-		modelAsBytes, err := stub.GetState(modelName)
-		if err != nil {
-			return shim.Error("Failed to get model: " + err.Error())
-		} else if modelAsBytes != nil {
-			return shim.Error("This model already exists: " + modelName)
-		}
+	return putModelFile(stub, &ModelFile{objectType, "", "", owner, modelType, libraryType, 0, fileHash, size, mediaType, schemaName, "", 0, "", "", args[7]})
+}
 
-		err = stub.PutState(modelName, modelJSONasBytes)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
+// putModelFile allocates the next model ID and base name for the model and stores it as its first version
+func putModelFile(stub shim.ChaincodeStubInterface, model *ModelFile) pb.Response {
+	ID, err := nextAssetID(stub, model.ObjectType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	baseName := "Model" + strconv.FormatUint(ID, 10)
+	model.ID = ID
+
+	// ==== Check if model already exists ====
+	lineageAsBytes, err := stub.GetState(modelLineageKey(baseName))
+	if err != nil {
+		return shim.Error("Failed to get model: " + err.Error())
+	} else if lineageAsBytes != nil {
+		return shim.Error("This model already exists: " + baseName)
+	}
+
+	lineage := &ModelLineage{"modelLineage", baseName, model.Owner, 1, 0}
+	return putModelVersion(stub, lineage, model, "", "Initial version")
+}
+
+//Methods for model versions ---------------------------------------------------------------------------------------
+
+func modelLineageKey(baseName string) string {
+	return "lineage" + baseName
+}
+
+// versions are stored as Model3_v1, Model3_v2, ... so results of every version are kept apart
+func modelVersionName(baseName string, version uint64) string {
+	return baseName + "_v" + strconv.FormatUint(version, 10)
+}
+
+func getModelLineage(stub shim.ChaincodeStubInterface, baseName string) (*ModelLineage, error) {
+	var lineage ModelLineage
+	lineageBytes, err := stub.GetState(modelLineageKey(baseName))
+	if err != nil {
+		return nil, err
+	} else if lineageBytes == nil {
+		return nil, Errorf("Model does not exist: %s", baseName)
+	}
+	err = json.Unmarshal(lineageBytes, &lineage)
+	if err != nil {
+		return nil, err
+	}
+	return &lineage, nil
+}
+
+func putModelLineage(stub shim.ChaincodeStubInterface, lineage *ModelLineage) error {
+	lineageAsBytes, err := json.Marshal(lineage)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(modelLineageKey(lineage.BaseName), lineageAsBytes)
+}
+
+// putModelVersion stores model as the next version of the lineage and returns the key it was stored under
+func putModelVersion(stub shim.ChaincodeStubInterface, lineage *ModelLineage, model *ModelFile, parent string, changelog string) pb.Response {
+	lineage.LatestVersion++
+	model.BaseName = lineage.BaseName
+	model.Version = lineage.LatestVersion
+	model.Name = modelVersionName(lineage.BaseName, model.Version)
+	model.Parent = parent
+	model.Changelog = changelog
+
+	err := checkTaskSubmission(stub, model.Task, model.ModelType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	modelJSONasBytes, err := json.Marshal(model)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// ==== Check if version already exists ====
+	modelAsBytes, err := stub.GetState(model.Name)
+	if err != nil {
+		return shim.Error("Failed to get model: " + err.Error())
+	} else if modelAsBytes != nil {
+		return shim.Error("This model already exists: " + model.Name)
+	}
+
+	err = stub.PutState(model.Name, modelJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = putModelLineage(stub, lineage)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = emitLifecycleEvent(stub, LifecycleEvent{Type: eventModelRegistered, Model: model.Name, Owner: model.Owner})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	// ==== Model saved . Return success ====
 
+	return shim.Success([]byte(model.Name))
+}
+
+// nextModelVersion reads the parent version a new version is derived from, the new version keeps its
+// model type, library type and feature schema
+func nextModelVersion(stub shim.ChaincodeStubInterface, baseName string, stringParentVersion string, owner string) (*ModelLineage, ModelFile, error) {
+	var parent ModelFile
+	lineage, err := getModelLineage(stub, baseName)
+	if err != nil {
+		return nil, parent, err
+	}
+	owner, err = resolveOwner(stub, owner)
+	if err != nil {
+		return nil, parent, err
+	}
+	if lineage.Owner != owner {
+		return nil, parent, Errorf("Model %s is owned by %s", baseName, lineage.Owner)
+	}
+	parentVersion, err := strconv.ParseUint(stringParentVersion, 10, 64)
+	if err != nil {
+		return nil, parent, err
+	}
+	parentBytes, err := stub.GetState(modelVersionName(baseName, parentVersion))
+	if err != nil {
+		return nil, parent, err
+	} else if parentBytes == nil {
+		return nil, parent, Errorf("Model %s has no version %d", baseName, parentVersion)
+	}
+	err = json.Unmarshal(parentBytes, &parent)
+	return lineage, parent, err
+}
+
+func (t *SimpleModel) publishModelVersion(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0        1        2            3                 4         5             6
+	//   "Model3", "", "1", "pruned deeper tree", sha256Hex, "20480", "application/zip"
+	if len(args) != 7 {
+		return shim.Error("Incorrect number of arguments. Expecting base name, owner, parent version, changelog, file hash, file size and media type")
+	}
+	lineage, parent, err := nextModelVersion(stub, args[0], args[2], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if isNativeModel(parent) {
+		return shim.Error("Native model versions are published with publishNativeModelVersion: " + args[0])
+	}
+	fileHash := strings.ToLower(args[4])
+	hashBytes, err := hex.DecodeString(fileHash)
+	if err != nil || len(hashBytes) != sha256.Size {
+		return shim.Error("Model file hash is not a SHA-256 hex digest: " + args[4])
+	}
+	size, err := strconv.ParseInt(args[5], 10, 64)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	model := &ModelFile{"modelFile", "", "", parent.Owner, parent.ModelType, parent.LibraryType, parent.ID, fileHash, size, args[6], parent.SchemaName, "", 0, "", "", parent.Task}
+	return putModelVersion(stub, lineage, model, parent.Name, args[3])
+}
+
+func (t *SimpleModel) publishNativeModelVersion(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0        1        2            3                                    4
+	//   "Model3", "", "1", "refit coefficients", "{\"Intercept\":-1.1,\"Coefficients\":[0.5,2.0]}"
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting base name, owner, parent version, changelog and model definition")
+	}
+	lineage, parent, err := nextModelVersion(stub, args[0], args[2], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isNativeModel(parent) {
+		return shim.Error("Model file versions are published with publishModelVersion: " + args[0])
+	}
+	definition := args[4]
+	err = checkNativeModel(stub, parent.ModelType, definition, parent.SchemaName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	model := &ModelFile{"modelFile", "", definition, parent.Owner, parent.ModelType, nativeLibraryType, parent.ID, sha256Hex([]byte(definition)), int64(len(definition)), "application/json", parent.SchemaName, "", 0, "", "", parent.Task}
+	return putModelVersion(stub, lineage, model, parent.Name, args[3])
+}
+
+func (t *SimpleModel) setDefaultModelVersion(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   	    0        1        2
+	//   "Model3", "", "2"
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting base name, owner and version")
+	}
+	lineage, err := getModelLineage(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	owner, err := resolveOwner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if lineage.Owner != owner {
+		return shim.Error("Model " + args[0] + " is owned by " + lineage.Owner)
+	}
+	version, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if version < 1 || version > lineage.LatestVersion {
+		return shim.Error(Sprintf("Model %s has no version %d", args[0], version))
+	}
+	lineage.DefaultVersion = version
+	err = putModelLineage(stub, lineage)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
+func (t *SimpleModel) getModelVersions(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting base name")
+	}
+	queryString := Sprintf("{\"selector\":{\"ObjectType\": \"modelFile\",\"BaseName\": %q}}", args[0])
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+func (t *SimpleModel) getAllModelLineages(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	queryString :="{\"selector\":{\"ObjectType\": \"modelLineage\"}}"
+	queryResults, err := getQueryResultForQueryString(stub, queryString)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(queryResults)
+}
+
+// initDataFile returns the name allocated for the data, it shares the counter of flexible data
 func (t *SimpleModel) initDataFile(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//   0        1            2          3
+	//   "", "1.1,1.4", "2.3,2.1", "0,1"
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting owner, x data, y data and class")
+	}
+	owner, err := resolveOwner(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sliceX := strings.Split(args[1], ",")
+	sliceY := strings.Split(args[2], ",")
+	sliceRes := strings.Split(args[3], ",")
 
-	batchName := args[0]
-	owner := args[1]
-	ID, err := strconv.ParseUint(args[2], 10, 64)
+	// x and y are the two feature columns
+	err = validateDataTable([][]string{sliceX, sliceY}, sliceRes, 2)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	sliceX := strings.Split(args[3], ",")
-	sliceY := strings.Split(args[4], ",")
-	sliceRes := strings.Split(args[5], ",")
 
 	objectType := "dataColumns"
 
+	ID, err := nextAssetID(stub, objectType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	batchName := "dataCol" + strconv.FormatUint(ID, 10)
+
+	// ==== Check if data already exists ====
+	dataAsBytes, err := stub.GetState(batchName)
+	if err != nil {
+		return shim.Error("Failed to get data: " + err.Error())
+	} else if dataAsBytes != nil {
+		return shim.Error("This data already exists: " + batchName)
+	}
+
 	currentModelData := &DataCol{objectType,sliceX,sliceY,sliceRes,owner, batchName,ID}
 	DataJSONasBytes, err := json.Marshal(currentModelData)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	err = stub.PutState(batchName, DataJSONasBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	return shim.Success(nil)
+	return shim.Success([]byte(batchName))
 }
 
 //Methods for parsing blockchain data -----------------------------------------------------------------------
@@ -957,6 +3715,35 @@ func getQueryResultForQueryString(stub shim.ChaincodeStubInterface, queryString
 	return buffer.Bytes(), nil
 }
 
+// paginated queries return the page as {"Records":[...],"RecordsCount":n,"Bookmark":"..."}, the bookmark is passed back for the next page
+func getQueryResultForQueryStringWithPagination(stub shim.ChaincodeStubInterface, queryString string, pageSize int32, bookmark string) ([]byte, error) {
+
+	resultsIterator, responseMetadata, err := stub.GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	buffer, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	var page bytes.Buffer
+	page.WriteString("{\"Records\":")
+	page.Write(buffer.Bytes())
+	page.WriteString(Sprintf(",\"RecordsCount\":%d", responseMetadata.FetchedRecordsCount))
+	bookmarkAsBytes, err := json.Marshal(responseMetadata.Bookmark)
+	if err != nil {
+		return nil, err
+	}
+	page.WriteString(",\"Bookmark\":")
+	page.Write(bookmarkAsBytes)
+	page.WriteString("}")
+
+	return page.Bytes(), nil
+}
+
 func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorInterface) (*bytes.Buffer, error) {
 	// buffer is a JSON array containing QueryResults
 	var buffer bytes.Buffer
@@ -972,10 +3759,13 @@ func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorI
 		if bArrayMemberAlreadyWritten == true {
 			buffer.WriteString(",")
 		}
+		// composite keys hold control characters so the key is written escaped
+		keyAsBytes, err := json.Marshal(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
 		buffer.WriteString("{\"Key\":")
-		buffer.WriteString("\"")
-		buffer.WriteString(queryResponse.Key)
-		buffer.WriteString("\"")
+		buffer.WriteString(string(keyAsBytes))
 
 		buffer.WriteString(", \"Record\":")
 		// Record is a JSON object, so we write as-is
@@ -997,25 +3787,21 @@ func calculateLogisticModelResults(XData string,YData string, currentModel Model
 	currentX, _=strconv.ParseFloat(XData,64)
 	currentY, _=strconv.ParseFloat(YData,64)
 
-	sum:= currentModel.Parameters[0]
-	sum += currentX * currentModel.Parameters[1]
-	sum += currentY * currentModel.Parameters[2]
-	result := 1 / (1 + math.Exp(-sum))
-
-	return result
+	logisticModel := LogisticModel{currentModel.Parameters[0], currentModel.Parameters[1:]}
+	return logisticModel.Predict([]float64{currentX, currentY})
 }
 
-func HttpPost(url string , data []byte) []byte{
+// HttpPost returns the response body, unreachable oracles and failed answers are returned as errors
+func HttpPost(url string , data []byte) ([]byte, error){
 	resp, err := http.Post(url,"application/json", bytes.NewBuffer(data))
 	if err != nil {
-		print(err)
+		return nil, err
 	}
 	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		print(err)
+	if resp.StatusCode != http.StatusOK {
+		return nil, Errorf("Oracle %s answered with status %s", url, resp.Status)
 	}
-	return body
+	return ioutil.ReadAll(resp.Body)
 }
 
 func  HttpGet(url string) []byte {
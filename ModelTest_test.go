@@ -0,0 +1,387 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	b64 "encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+)
+
+// endorsingStub behaves like a peer during endorsement: reads see committed state only,
+// writes are collected and applied by commit
+type endorsingStub struct {
+	*shim.MockStub
+	creator []byte
+	writes  map[string][]byte
+}
+
+func newEndorsingStub(t *testing.T, mspID string, commonName string) *endorsingStub {
+	return newEndorsingStubWithRole(t, mspID, commonName, "")
+}
+
+func newEndorsingStubWithRole(t *testing.T, mspID string, commonName string, role string) *endorsingStub {
+	return &endorsingStub{shim.NewMockStub("ModelTest", new(SimpleModel)), testCreator(t, mspID, commonName, role), map[string][]byte{}}
+}
+
+func (stub *endorsingStub) GetCreator() ([]byte, error) {
+	return stub.creator, nil
+}
+
+func (stub *endorsingStub) PutState(key string, value []byte) error {
+	stub.writes[key] = value
+	return nil
+}
+
+func (stub *endorsingStub) commit() {
+	stub.MockTransactionStart("commit")
+	for key, value := range stub.writes {
+		stub.MockStub.PutState(key, value)
+	}
+	stub.MockTransactionEnd("commit")
+	stub.writes = map[string][]byte{}
+}
+
+// testCreator serializes a self signed certificate the way the peer passes the submitter to chaincode,
+// the role is added as the certificate attribute the Fabric CA issues
+func testCreator(t *testing.T, mspID string, commonName string, role string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if role != "" {
+		template.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: []byte(`{"attrs":{"role":"` + role + `"}}`)}}
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: certPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return creator
+}
+
+func putTestState(t *testing.T, stub *endorsingStub, key string, value interface{}) {
+	valueAsBytes, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.writes[key] = valueAsBytes
+}
+
+func putTestResults(t *testing.T, stub *endorsingStub, modelName string, dataName string) {
+	resultsKey, err := stub.CreateCompositeKey("results", []string{modelName, dataName, "tx0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	putTestState(t, stub, resultsKey, ResultsArray{ObjectType: "results", Results: []float64{0.2, 0.8}, ModelName: modelName, DataColName: dataName, TxID: "tx0"})
+}
+
+func testBalance(t *testing.T, stub *endorsingStub, owner string) uint64 {
+	account, err := getTokenAccount(stub, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account.Balance
+}
+
+func TestSplitRewardPool(t *testing.T) {
+	cases := []struct {
+		name    string
+		pool    uint64
+		shapley []float64
+		amounts []uint64
+	}{
+		{"proportional", 100, []float64{0.1, 0.2, 0.3}, []uint64{17, 33, 50}},
+		{"largest remainder", 2, []float64{1, 1, 1}, []uint64{1, 1, 0}},
+		{"single payout", 7, []float64{0.004}, []uint64{7}},
+		{"tiny values", 10, []float64{1e-12, 3e-12}, []uint64{3, 7}},
+	}
+	for _, c := range cases {
+		payouts := make([]RewardPayout, len(c.shapley))
+		for i, shapley := range c.shapley {
+			payouts[i] = RewardPayout{Shapley: shapley}
+		}
+		splitRewardPool(c.pool, payouts)
+		var paid uint64
+		for i, payout := range payouts {
+			paid += payout.Amount
+			if payout.Amount != c.amounts[i] {
+				t.Errorf("%s: payout %d is %d, want %d", c.name, i, payout.Amount, c.amounts[i])
+			}
+		}
+		if paid != c.pool {
+			t.Errorf("%s: paid %d of pool %d", c.name, paid, c.pool)
+		}
+	}
+}
+
+func TestDistributeRewardsRepeatedOwner(t *testing.T) {
+	distributor := "Org1MSP::Admin@org1.example.com"
+	owner := "Org2MSP::User1@org2.example.com"
+	stub := newEndorsingStub(t, "Org1MSP", "Admin@org1.example.com")
+	putTestState(t, stub, tokenAccountKey(distributor), TokenAccount{"tokenAccount", distributor, 100})
+	putTestState(t, stub, tokenAccountKey(owner), TokenAccount{"tokenAccount", owner, 5})
+	putTestState(t, stub, "Model0_v1", ModelFile{ObjectType: "modelFile", Name: "Model0_v1", Owner: owner})
+	putTestState(t, stub, "dataCol0", DataFlex{ObjectType: "dataFlex", DataName: "dataCol0", Owner: owner})
+	putTestResults(t, stub, "Model0_v1", "dataCol0")
+	stub.commit()
+
+	stub.MockTransactionStart("tx1")
+	response := new(SimpleModel).distributeRewards(stub, []string{"round-1", "100", `{"Models":{"Model0_v1":0.3},"Data":{"dataCol0":0.1}}`, ""})
+	stub.MockTransactionEnd("tx1")
+	if response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	stub.commit()
+
+	if balance := testBalance(t, stub, owner); balance != 105 {
+		t.Errorf("owner of both assets has %d tokens, want 105", balance)
+	}
+	if balance := testBalance(t, stub, distributor); balance != 0 {
+		t.Errorf("distributor has %d tokens, want 0", balance)
+	}
+}
+
+func TestDistributeRewardsRequiresResults(t *testing.T) {
+	distributor := "Org1MSP::Admin@org1.example.com"
+	stub := newEndorsingStub(t, "Org1MSP", "Admin@org1.example.com")
+	putTestState(t, stub, tokenAccountKey(distributor), TokenAccount{"tokenAccount", distributor, 100})
+	putTestState(t, stub, "Model0_v1", ModelFile{ObjectType: "modelFile", Name: "Model0_v1", Owner: distributor})
+	putTestState(t, stub, "Model1_v1", ModelFile{ObjectType: "modelFile", Name: "Model1_v1", Owner: distributor})
+	putTestState(t, stub, "dataCol0", DataFlex{ObjectType: "dataFlex", DataName: "dataCol0", Owner: distributor})
+	putTestResults(t, stub, "Model0_v1", "dataCol0")
+	stub.commit()
+
+	stub.MockTransactionStart("tx1")
+	response := new(SimpleModel).distributeRewards(stub, []string{"round-1", "100", `{"Models":{"Model0_v1":0.5,"Model1_v1":0.5}}`, ""})
+	stub.MockTransactionEnd("tx1")
+	if response.Status == shim.OK {
+		t.Error("round paid a model without recorded results")
+	}
+	if len(stub.writes) != 0 {
+		t.Errorf("refused round wrote %d keys", len(stub.writes))
+	}
+}
+
+func TestDistributeRewardsDistributorOwnsAsset(t *testing.T) {
+	distributor := "Org1MSP::Admin@org1.example.com"
+	owner := "Org2MSP::User1@org2.example.com"
+	stub := newEndorsingStub(t, "Org1MSP", "Admin@org1.example.com")
+	putTestState(t, stub, tokenAccountKey(distributor), TokenAccount{"tokenAccount", distributor, 100})
+	putTestState(t, stub, "Model0_v1", ModelFile{ObjectType: "modelFile", Name: "Model0_v1", Owner: distributor})
+	putTestState(t, stub, "dataCol0", DataFlex{ObjectType: "dataFlex", DataName: "dataCol0", Owner: owner})
+	putTestResults(t, stub, "Model0_v1", "dataCol0")
+	stub.commit()
+
+	stub.MockTransactionStart("tx1")
+	response := new(SimpleModel).distributeRewards(stub, []string{"round-1", "100", `{"Models":{"Model0_v1":0.5},"Data":{"dataCol0":0.5}}`, ""})
+	stub.MockTransactionEnd("tx1")
+	if response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	stub.commit()
+
+	distributorBalance := testBalance(t, stub, distributor)
+	ownerBalance := testBalance(t, stub, owner)
+	if distributorBalance != 50 || ownerBalance != 50 {
+		t.Errorf("balances are %d and %d, want 50 and 50", distributorBalance, ownerBalance)
+	}
+	if distributorBalance+ownerBalance != 100 {
+		t.Errorf("distribution changed the token supply to %d", distributorBalance+ownerBalance)
+	}
+}
+
+func testOracleKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}))
+}
+
+func testOracleSignature(t *testing.T, key *ecdsa.PrivateKey, message []byte) string {
+	digest := sha256.Sum256(message)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatureBytes, err := asn1.Marshal(ecdsaSignature{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b64.StdEncoding.EncodeToString(signatureBytes)
+}
+
+func TestVerifyOracleSignature(t *testing.T) {
+	key, publicKeyPEM := testOracleKey(t)
+	_, otherPublicKeyPEM := testOracleKey(t)
+	response := `{"Results":[0.2,0.8]}`
+	signature := testOracleSignature(t, key, validationMessage("modelHash", "dataHash", response))
+
+	if err := verifyOracleSignature(publicKeyPEM, validationMessage("modelHash", "dataHash", response), signature); err != nil {
+		t.Errorf("signature of the registered oracle is refused: %v", err)
+	}
+	if err := verifyOracleSignature(publicKeyPEM, validationMessage("modelHash", "dataHash", `{"Results":[0.9,0.8]}`), signature); err == nil {
+		t.Error("signature is accepted for a changed response")
+	}
+	if err := verifyOracleSignature(publicKeyPEM, validationMessage("modelHash", "otherDataHash", response), signature); err == nil {
+		t.Error("signature is accepted for other data")
+	}
+	if err := verifyOracleSignature(otherPublicKeyPEM, validationMessage("modelHash", "dataHash", response), signature); err == nil {
+		t.Error("signature is accepted with the key of another oracle")
+	}
+}
+
+func TestCanReadPrivateDataOnlyInCollectionOrganisation(t *testing.T) {
+	data := DataFlex{ObjectType: "dataColumns", DataName: "dataCol0", Owner: "Org1MSP::User1@org1.example.com", Private: true, Collection: dataCollectionPrefix + "Org1MSP"}
+	cases := []struct {
+		mspID      string
+		commonName string
+		role       string
+		allowed    bool
+	}{
+		{"Org1MSP", "User1@org1.example.com", roleDataProvider, true},
+		{"Org1MSP", "User2@org1.example.com", roleDataProvider, false},
+		{"Org1MSP", "User3@org1.example.com", roleEvaluator, true},
+		{"Org2MSP", "User1@org2.example.com", roleEvaluator, false},
+	}
+	for _, c := range cases {
+		stub := newEndorsingStubWithRole(t, c.mspID, c.commonName, c.role)
+		allowed, err := canReadPrivateData(stub, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != c.allowed {
+			t.Errorf("%s %s with role %s may read private data of Org1MSP: %v, want %v", c.mspID, c.commonName, c.role, allowed, c.allowed)
+		}
+	}
+}
+
+func TestInitDataFileAllocatesKeys(t *testing.T) {
+	stub := newEndorsingStub(t, "Org1MSP", "User1@org1.example.com")
+	var names []string
+	for _, class := range []string{"0,1", "1,0"} {
+		stub.MockTransactionStart("tx-" + class)
+		response := new(SimpleModel).initDataFile(stub, []string{"", "1.1,1.2", "2.1,2.2", class})
+		stub.MockTransactionEnd("tx-" + class)
+		if response.Status != shim.OK {
+			t.Fatal(response.Message)
+		}
+		stub.commit()
+		names = append(names, string(response.Payload))
+	}
+	if names[0] == names[1] {
+		t.Fatalf("both uploads were stored as %s", names[0])
+	}
+	for i, class := range []string{"0,1", "1,0"} {
+		var data DataCol
+		err := json.Unmarshal(stub.State[names[i]], &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(data.Class, ",") != class || data.Owner != "Org1MSP::User1@org1.example.com" {
+			t.Errorf("%s holds class %v of %s", names[i], data.Class, data.Owner)
+		}
+	}
+}
+
+// historyStub keeps committed writes as key history, the mock stub has no history database
+type historyStub struct {
+	*endorsingStub
+	history map[string][]*queryresult.KeyModification
+}
+
+type historyIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool {
+	return len(it.modifications) > 0
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	modification := it.modifications[0]
+	it.modifications = it.modifications[1:]
+	return modification, nil
+}
+
+func (it *historyIterator) Close() error {
+	return nil
+}
+
+func (stub *historyStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{stub.history[key]}, nil
+}
+
+func (stub *historyStub) commit(txID string) {
+	for key, value := range stub.writes {
+		stub.history[key] = append(stub.history[key], &queryresult.KeyModification{TxId: txID, Value: value})
+	}
+	stub.endorsingStub.commit()
+}
+
+func TestHistoryRecordsCreatorMSP(t *testing.T) {
+	stub := &historyStub{newEndorsingStub(t, "Org1MSP", "User1@org1.example.com"), map[string][]*queryresult.KeyModification{}}
+	resultsKey, err := stub.CreateCompositeKey("results", []string{"model1", "data1", "tx0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// written before creators were recorded
+	stub.writes[resultsKey] = []byte(`{"docType":"results"}`)
+	stub.commit("tx0")
+	for _, tx := range []struct{ txID, mspID string }{{"tx1", "Org1MSP"}, {"tx2", "Org2MSP"}} {
+		stub.creator = testCreator(t, tx.mspID, "User1", "")
+		err = (&creatorRecordingStub{ChaincodeStubInterface: stub}).PutState(resultsKey, []byte(`{"docType":"results"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.commit(tx.txID)
+	}
+
+	response := new(SimpleModel).getHistoryForKey(stub, []string{resultsKey})
+	if response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	var history []HistoryEntry
+	err = json.Unmarshal(response.Payload, &history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"tx0": "", "tx1": "Org1MSP", "tx2": "Org2MSP"}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d entries, want %d", len(history), len(want))
+	}
+	for _, entry := range history {
+		if entry.CreatorMSP != want[entry.TxID] {
+			t.Errorf("%s was created by %q, want %q", entry.TxID, entry.CreatorMSP, want[entry.TxID])
+		}
+	}
+}
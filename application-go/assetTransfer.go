@@ -8,15 +8,27 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
 	b64 "encoding/base64"
 	"encoding/binary"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
 	"fmt"
 	"github.com/go-echarts/go-echarts/v2/charts"
 	"github.com/go-echarts/go-echarts/v2/opts"
 	chartrender "github.com/go-echarts/go-echarts/v2/render"
 	"github.com/go-echarts/go-echarts/v2/types"
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
 	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
 	"github.com/pa-m/sklearn/metrics"
@@ -26,6 +38,8 @@ import (
 	"io/ioutil"
 	"log"
 	"math"
+	"math/big"
+	"math/bits"
 	"math/rand"
 	"net/http"
 	"os"
@@ -33,6 +47,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 type ModelFile struct{
@@ -43,6 +58,15 @@ type ModelFile struct{
 	ModelType		string `json:"ModelType"`
 	LibraryType string `json:"LibraryType"`
 	ID uint64
+	Hash string `json:"Hash"`
+	Size int64 `json:"Size"`
+	MediaType string `json:"MediaType"`
+	SchemaName string `json:"SchemaName"`
+	BaseName string `json:"BaseName"`
+	Version uint64 `json:"Version"`
+	Parent string `json:"Parent"`
+	Changelog string `json:"Changelog"`
+	Task string `json:"Task"`
 	Logloss string
 	Accuracy string
 
@@ -55,10 +79,12 @@ type ModelResults struct{
 
 type ResultsArray struct{
 	ObjectType 	string `json:"ObjectType"`
-	id int64
 	Results []float64 `json:"Results"`
 	ModelName string `json:"ModelName"`
 	DataColName string `json:"DataColName"`
+	TxID string `json:"TxID"`
+	ModelVersion uint64 `json:"ModelVersion"`
+	Task string `json:"Task"`
 }
 
 
@@ -66,12 +92,30 @@ type ModelWrapper struct{
 	Key   string `json:"Key"`
 	Record ModelFile `json:"Record"`
 	Shapley string `json:"Shapley"`
+	ShapleyStdErr string `json:"ShapleyStdErr"`
+	FusionWeight string `json:"FusionWeight"`
+	Default bool `json:"Default"`
+}
+
+type ModelLineage struct{
+	ObjectType 	string `json:"ObjectType"`
+	BaseName string `json:"BaseName"`
+	Owner string `json:"Owner"`
+	DefaultVersion uint64 `json:"DefaultVersion"`
+	LatestVersion uint64 `json:"LatestVersion"`
+}
+
+type ModelLineageWrapper struct{
+	Key    string 	`json:"Key"`
+	Record ModelLineage 	`json:"Record"`
 }
 
 
 type DataFlexWrapper struct{
 	Key    string 	`json:"Key"`
 	Record DataFlex	`json:"Record"`
+	Shapley string `json:"Shapley"`
+	ShapleyStdErr string `json:"ShapleyStdErr"`
 }
 
 
@@ -91,17 +135,175 @@ type DataFlex struct{
 	Owner string `json:"Owner"`
 	DataName string  `json:"DataName"`
 	ID uint64   `json:"Id"`
+	Hash string `json:"Hash"`
+	Private bool `json:"Private"`
+	Rows int `json:"Rows"`
+	Columns int `json:"Columns"`
+	SchemaName string `json:"SchemaName"`
+	Task string `json:"Task"`
+	ClassLabel string `json:"ClassLabel"`
+	Collection string `json:"Collection"`
+}
+
+type FilePayload struct{
+	Data DataFlex `json:"Data"`
+	Model ModelFile `json:"Model"`
+}
+
+type ValidationRequest struct{
+	ObjectType 	string `json:"ObjectType"`
+	ModelName string `json:"ModelName"`
+	DataColName string `json:"DataColName"`
+	ModelHash string `json:"ModelHash"`
+	DataHash string `json:"DataHash"`
+	Status string `json:"Status"`
+	TxID string `json:"TxID"`
+	Reason string `json:"Reason"`
+}
+
+type FeatureSchema struct{
+	ObjectType 	string `json:"ObjectType"`
+	Name string `json:"Name"`
+	Features []SchemaFeature `json:"Features"`
+	Owner string `json:"Owner"`
+}
+
+type SchemaFeature struct{
+	Name string `json:"Name"`
+	Type string `json:"Type"`
+}
+
+type FeatureSchemaWrapper struct{
+	Key    string 	`json:"Key"`
+	Record FeatureSchema 	`json:"Record"`
+}
+
+type ValidationRequestWrapper struct{
+	Key    string 	`json:"Key"`
+	Record ValidationRequest 	`json:"Record"`
+	OracleUrl string `json:"OracleUrl,omitempty"`
+}
+
+type OracleRegistry struct{
+	ObjectType 	string `json:"ObjectType"`
+	LibraryType string `json:"LibraryType"`
+	Url string `json:"Url"`
+	Enabled bool `json:"Enabled"`
+	PublicKey string `json:"PublicKey"`
+}
+
+type OracleRegistryWrapper struct{
+	Key    string 	`json:"Key"`
+	Record OracleRegistry 	`json:"Record"`
+}
+
+type HistoryEntry struct{
+	TxID string `json:"TxID"`
+	Timestamp string `json:"Timestamp"`
+	CreatorMSP string `json:"CreatorMSP"`
+	IsDelete bool `json:"IsDelete"`
+	Value json.RawMessage `json:"Value"`
+}
+
+// AuditKey is a ledger key offered on the audit page, composite result keys contain zero bytes so the form sends them hex encoded
+type AuditKey struct{
+	Kind string
+	Label string
+	Value string
+}
+
+type AuditPage struct{
+	Keys []AuditKey
+	Selected string
+	History []HistoryEntry
+	Error string
+}
+
+type Task struct{
+	ObjectType string `json:"ObjectType"`
+	Name string `json:"Name"`
+	Description string `json:"Description"`
+	TargetLabel string `json:"TargetLabel"`
+	ModelTypes []string `json:"ModelTypes"`
+	Metric string `json:"Metric"`
+	Deadline string `json:"Deadline"`
+	Owner string `json:"Owner"`
+}
+
+type TaskWrapper struct{
+	Key    string 	`json:"Key"`
+	Record Task 	`json:"Record"`
+}
+
+type HomePage struct{
+	Schemas []FeatureSchemaWrapper
+	Tasks []TaskWrapper
+	ValidationSkipped bool
+}
+
+type TokenAccount struct{
+	ObjectType string `json:"ObjectType"`
+	Owner string `json:"Owner"`
+	Balance uint64 `json:"Balance"`
+}
+
+type TokenAccountWrapper struct{
+	Key    string 	`json:"Key"`
+	Record TokenAccount 	`json:"Record"`
+}
+
+// Shapley values of the last results page keyed by model and data names, distributed as one reward round
+type RewardShares struct{
+	Models map[string]float64 `json:"Models"`
+	Data map[string]float64 `json:"Data"`
+}
+
+type RewardPayout struct{
+	Asset string `json:"Asset"`
+	Owner string `json:"Owner"`
+	Shapley float64 `json:"Shapley"`
+	Amount uint64 `json:"Amount"`
+}
+
+type RewardRound struct{
+	ObjectType string `json:"ObjectType"`
+	Round string `json:"Round"`
+	Task string `json:"Task"`
+	Pool uint64 `json:"Pool"`
+	Distributor string `json:"Distributor"`
+	Payouts []RewardPayout `json:"Payouts"`
+	TxID string `json:"TxID"`
+}
+
+type RewardRoundWrapper struct{
+	Key    string 	`json:"Key"`
+	Record RewardRound 	`json:"Record"`
 }
 
+type WalletPage struct{
+	Account TokenAccount
+	Accounts []TokenAccountWrapper
+	Rounds []RewardRoundWrapper
+}
 
 type ResTable struct{
+	 ValidationSkipped bool
+	 Task Task
+	 Tasks []TaskWrapper
 	 Res []ResultsWrapper
 	 Data []DataFlexWrapper
 	 Models []ModelWrapper
+	 Skipped []ValidationRequestWrapper
+	 Events []LifecycleEvent
 	 ShapleyValues []float64
 	 ShapleyLog[][]float64
+	 ModelEstimator string
+	 DataEstimator string
+	 BalancedAUC float64
 	 BalancedLogLoss float64
+	 ShapleyAdjustedAUC float64
 	 ShapleyAdjustedLogLoss float64
+	 RewardShares string
 	 Graphs []template.HTML
 }
 
@@ -109,9 +311,22 @@ var tmplLogin *template.Template
 var tmplHomepage *template.Template
 var tmplBenchmark *template.Template
 var tmplResults *template.Template
+var tmplAudit *template.Template
+var tmplForbidden *template.Template
+var tmplWallet *template.Template
 var contract *gateway.Contract
-var ShapleyModellog [][]float64
-var ShapleyDatalog [][]float64
+// qscc system chaincode of the channel, transactions are read from it by ID
+var ledgerContract *gateway.Contract
+var ledgerChannel string
+
+// chaincode stores assets under the identity of the wallet user, admin identities may set ASSET_OWNER to act for another owner
+var requestedOwner = os.Getenv("ASSET_OWNER")
+
+// the oracle worker signs results of PMML and native models it evaluates without an oracle with the PEM private key
+// in ORACLE_SIGNING_KEY, its public key is registered as the PMML and GO oracle
+var oracleSigningKey = os.Getenv("ORACLE_SIGNING_KEY")
+
+const oracleWorkerInterval = 10 * time.Second
 
 func main() {
 	contract = initContract()
@@ -121,13 +336,28 @@ func main() {
 	http.HandleFunc("/", home)
 	http.HandleFunc("/modelPost", uploadModel)
 	http.HandleFunc("/dataPost", uploadDataFlex2)
+	http.HandleFunc("/schemaPost", registerSchema)
+	http.HandleFunc("/taskPost", createTask)
+	http.HandleFunc("/defaultVersionPost", setDefaultVersion)
 	http.HandleFunc("/benchmark", benchamarkPage)
 	http.HandleFunc("/benchmarkPost", runBenchmark)
 	http.HandleFunc("/validatePost", runValidate)
 	http.HandleFunc("/showResults", displayResults)
+	http.HandleFunc("/audit", auditPage)
 	http.HandleFunc("/charts", httpserver)
+	http.HandleFunc("/blobs/", serveBlob)
+	http.HandleFunc("/events", streamEvents)
+	http.HandleFunc("/wallet", walletPage)
+	http.HandleFunc("/transferPost", transferTokens)
+	http.HandleFunc("/mintPost", mintTokens)
+	http.HandleFunc("/distributePost", distributeRewards)
 	parseTemplates()
 
+	go listenLifecycleEvents(contract)
+
+	// worker also serves blob store and PMML models, which are validated off-chain in every mode
+	go runOracleWorker(contract, oracleWorkerInterval)
+
 	log.Fatal(http.ListenAndServe(":9111", nil))
 }
 
@@ -143,7 +373,6 @@ func generateLineItems() []opts.LineData {
 func appendLineItems(accuracy []float64) []opts.LineData {
 	items := make([]opts.LineData, 0)
 	for _, val := range accuracy {
-		fmt.Println(val)
 		items = append(items, opts.LineData{Value: val})
 	}
 	return items
@@ -201,6 +430,9 @@ func parseTemplates() {
 	tmplHomepage = template.Must(template.ParseFiles("/home/vdledger/HLtwothree/fabric-samples/asset-transfer-basic/application-go/UI/Homepage.html"))
 	tmplBenchmark = template.Must(template.ParseFiles("/home/vdledger/HLtwothree/fabric-samples/asset-transfer-basic/application-go/UI/testpage.html"))
 	tmplResults = template.Must(template.ParseFiles("/home/vdledger/HLtwothree/fabric-samples/asset-transfer-basic/application-go/UI/Results.html"))
+	tmplAudit = template.Must(template.ParseFiles("/home/vdledger/HLtwothree/fabric-samples/asset-transfer-basic/application-go/UI/Audit.html"))
+	tmplForbidden = template.Must(template.ParseFiles("/home/vdledger/HLtwothree/fabric-samples/asset-transfer-basic/application-go/UI/Forbidden.html"))
+	tmplWallet = template.Must(template.ParseFiles("/home/vdledger/HLtwothree/fabric-samples/asset-transfer-basic/application-go/UI/Wallet.html"))
 }
 
 func login(reswt http.ResponseWriter, req *http.Request,) {
@@ -209,15 +441,46 @@ func login(reswt http.ResponseWriter, req *http.Request,) {
 }
 
 func home(reswt http.ResponseWriter, req *http.Request) {
-	tmplHomepage.ExecuteTemplate(reswt, "Homepage.html", nil)
+	var page HomePage
+	var err error
+	page.Schemas, err = getFeatureSchemaArray(contract)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	page.Tasks, err = getTaskArray(contract)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	page.ValidationSkipped = req.URL.Query().Get("validation") == "skipped"
+	tmplHomepage.ExecuteTemplate(reswt, "Homepage.html", page)
 }
 
 func benchamarkPage(reswt http.ResponseWriter, req *http.Request) {
 	tmplBenchmark.ExecuteTemplate(reswt, "testpage.html", nil)
 }
 
+// runValidate validates the default version of the model base name on the data
 func runValidate(reswt http.ResponseWriter, req *http.Request){
-	initValidate(contract,"Model0","dataCol0")
+	req.ParseMultipartForm(10 << 20)
+	baseName := req.FormValue("modelName")
+	dataName := req.FormValue("dataName")
+	if baseName == "" || dataName == "" {
+		http.Error(reswt, "model name and data name are required", http.StatusBadRequest)
+		return
+	}
+	model, err := getDefaultModelVersion(contract, baseName)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	err = initValidate(contract, model.Name, dataName)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	http.Redirect(reswt,req,"/showResults",302)
 }
 
 func displayResults(reswt http.ResponseWriter, req *http.Request){
@@ -225,13 +488,47 @@ func displayResults(reswt http.ResponseWriter, req *http.Request){
 	//var TotalResults []float64
 	var TotalData []float64
 	var ModelRes []ModelResults
-	var combinedKeys string
 
 
 
-	wrappedModel := getModelArray(contract)
-	wrappedData := getDataArray(contract)
-	wrappedResult := getResultArray(contract)
+	resTable.ValidationSkipped = req.URL.Query().Get("validation") == "skipped"
+
+	// with ?task= only models, data and results of the task are shown and ranked by its metric
+	taskName := req.URL.Query().Get("task")
+	if taskName != "" {
+		task, err := getTask(contract, taskName)
+		if err != nil {
+			writeTransactionError(reswt, err)
+			return
+		}
+		resTable.Task = task
+	}
+	var err error
+	resTable.Tasks, err = getTaskArray(contract)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+
+	wrappedModel, err := getModelArray(contract, "", "", "", "", taskName)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	wrappedData, err := getDataArray(contract, "", "", taskName)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	wrappedResult, err := getResultArray(contract, "", "", taskName)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	// empty filter matches every task, without ?task= only assets submitted to no task are valued together
+	if taskName == "" {
+		wrappedModel, wrappedData, wrappedResult = withoutTask(wrappedModel, wrappedData, wrappedResult)
+	}
 
 	//creating maps for calculating Shapley values
 	modelResMap := make(map[string][]float64)
@@ -270,8 +567,6 @@ func displayResults(reswt http.ResponseWriter, req *http.Request){
 
 	modelMap := make(map[string]ModelFile)
 	for i := 0; i < len(wrappedModel); i++ {
-		combinedKeys = combinedKeys + strconv.Itoa(i)
-
 		// data manipulation fro presenting in  website table
 		if wrappedModel[i].Record.ModelType == "LR"{
 			wrappedModel[i].Record.ModelType = "Logistic regression"
@@ -283,6 +578,9 @@ func displayResults(reswt http.ResponseWriter, req *http.Request){
 		if wrappedModel[i].Record.LibraryType == "AS"{
 			wrappedModel[i].Record.LibraryType = "PySpark"
 		}
+		if wrappedModel[i].Record.LibraryType == "GO"{
+			wrappedModel[i].Record.LibraryType = "Native"
+		}
 
 
 		modelMap[wrappedModel[i].Key] = wrappedModel[i].Record
@@ -305,255 +603,117 @@ func displayResults(reswt http.ResponseWriter, req *http.Request){
 	}
 
 
-	//fmt.Println("Generating combinations")
-	////fmt.Println(combinedKeys)
-	////fmt.Println(gonum.Combinations(len(wrappedModel),2))
-	//var keySequenceSliceModel []string
-	//// this loop is not like the others take notice
-	//j := 1
-	//for i := 0; i < len(combinedKeys); i++ {
-	//	fmt.Println(combinedKeys[0:j],j)
-	//	keySequenceSliceModel = append(keySequenceSliceModel,combinedKeys[0:j])
-	//	j++
-	//}
-
-	//fmt.Println(keySequenceSliceModel)
-	//fulllenghtseq := generateSequence(len(wrappedModel)+1)
-	//fmt.Println(fulllenghtseq)
-
-
-	// prepeating premutation keys for data and models
-	// keysequence required to sum model
-	// calcualtion sequence defines all available premutations
-
-		var keySequenceSliceData []string
-		//var keySequenceSliceModel []string
-		var calculationSliceModel []string
-		var calculationSliceData []string
-		if len(wrappedModel) >1{
-			//keysequenceModel := generateModelKeys(len(wrappedModel))
-			//Perm([]rune(keysequenceModel), func(a []rune) {
-			//	calculationSliceModel = append(calculationSliceModel, string(a))
-			//})
-			//keySequenceSliceModel=generateSequence(len(wrappedModel))
-
-		}else{
-			calculationSliceModel = append(calculationSliceModel, "0")
-			//keySequenceSliceModel = append(keySequenceSliceModel, "0")
-		}
-		if len(wrappedData) >1{
-			keysequenceData := generateModelKeys(len(wrappedData))
-			Perm([]rune(keysequenceData), func(a []rune) {
-				calculationSliceData = append( calculationSliceData, string(a))
-			})
-			fmt.Println(calculationSliceData)
-			keySequenceSliceData= generateSequence(len(wrappedData))
-		}else{
-			calculationSliceData = append( calculationSliceData, "0")
-			keySequenceSliceData = append( keySequenceSliceData, "0")
-		}
-
-
-		fmt.Println("modelkeyseq")
-		//fmt.Println(keySequenceSliceModel)
-		fmt.Println("datakeyseq")
-		fmt.Println(keySequenceSliceData)
-
-
-	fmt.Println("Calculating ALL model ensembles")
-	// calculating combination of all possible model responses of all combined data
-	var allModelPAvg []float64
-
-	for i := 0; i < len(modelResMap["Model0"]) ; i++ {
-		sum := 0.0
-		for _,val := range modelResMap {
-			sum += val[i]
-		}
-		allModelPAvg = append(allModelPAvg, sum/float64(len(modelResMap)))
-	}
-
-	allModelLogloss := AUC(TotalData,allModelPAvg)
-
-	GraphResults := []float64{0.751451431060098,0.781546071514257,0.775746229283783,0.776087043927997,0.788871415570935}
-	fmt.Println("Calculating all combination predictions")
-	// summing predictions based on key sequence
-	CombinedModelResults := make(map[string]float64)
-	//for _,keyseq := range keySequenceSliceModel {
-	//	var keysForAppending []string
-	//	for _, v := range keyseq {
-	//		key := "Model"+ string(v)
-	//		keysForAppending = append(keysForAppending, key)
-	//	}
-	//	fmt.Println(keyseq)
-	//	var summedpredictions []float64
-	//	if len(keyseq) > 1{
-	//		for i := 0; i < len(keysForAppending)-1 ; i++ {
-	//			if i == 0 {
-	//				var newFloatSlice []float64
-	//				summedpredictions = SumPredictions(modelResMap[keysForAppending[i]],modelResMap[keysForAppending[i+1]], newFloatSlice)
-	//			}else{
-	//				summedpredictions = SumPredictions(modelResMap[keysForAppending[i]],modelResMap[keysForAppending[i+1]], summedpredictions)
-	//			}
-	//		}
-	//		summedpredictions = DividePredictions(summedpredictions, float64(len(keysForAppending)))
-	//	}else{
-	//		fmt.Println(keyseq)
-	//		fmt.Println(modelResMap)
-	//		summedpredictions = modelResMap["Model"+keyseq]
-	//	}
-	//	CombinedModelResults[keyseq] = AUC(TotalData,summedpredictions)
-	//	GraphResults =
-	//}
-	//
-	//CombinedModelResultsforEachDataB := make(map[string][]float64)
-
-	//for _, data := range dataMap {
-	//	var keys []string
-	//	var tempFPSlice []float64
-	//	for key, results := range resultMap {
-	//		if results.DataColName == data.DataName {
-	//			keys = append(keys, key)
-	//		}
-	//	}
-	//	for i := 0; i < len(keys)-1 ; i++ {
-	//		if i == 0 {
-	//			var newFloatSlice []float64
-	//			tempFPSlice = SumPredictions(resultMap[keys[i]].Results,resultMap[keys[i+1]].Results, newFloatSlice)
-	//		}else{
-	//			tempFPSlice = SumPredictions(resultMap[keys[i]].Results,resultMap[keys[i+1]].Results, tempFPSlice)
-	//		}
-	//	}
-	//	tempFPSlice = DividePredictions(tempFPSlice, float64(len(keys)))
-	//	CombinedModelResultsforEachDataB[data.DataName] = tempFPSlice
-	//}
-	//fmt.Println("-----")
-	//fmt.Println(len(CombinedModelResultsforEachDataB))
-	//
-	//
-	////CombinedDataResults := make(map[string]float64)
-	//
-	//for _,keyseq := range keySequenceSliceData{
-	//	var keysForAppending []string
-	//	for _, v := range keyseq {
-	//		key := "dataCol"+ string(v)
-	//		keysForAppending = append(keysForAppending, key)
-	//	}
-	//	fmt.Println(keysForAppending)
-	//	var combinedDataB []float64
-	//	var combinedResultB []float64
-	//	if len(keyseq) > 1{
-	//		for i := 0; i < len(keysForAppending) ; i++ {
-	//			var tempFCSlice []float64
-	//			for _, v  := range dataMap[keysForAppending[i]].Class {
-	//				floatClass,_  := strconv.ParseFloat(v, 64)
-	//				tempFCSlice = append(tempFCSlice, floatClass)
-	//			}
-	//			combinedDataB = append(combinedDataB, tempFCSlice...)
-	//			combinedResultB = append(combinedResultB,CombinedModelResultsforEachDataB[keysForAppending[i]]...)
-	//		}
-	//		fmt.Println(len(combinedResultB))
-	//		fmt.Println(len(combinedDataB))
-	//	}else{
-	//		combinedDataB = TotalData
-	//		firstkey := "dataCol0"
-	//		for i := 0; i < len(TotalData) ; i++ {
-	//			var tempFCSlice []float64
-	//			for _, v  := range dataMap[firstkey].Class {
-	//				floatClass,_  := strconv.ParseFloat(v, 64)
-	//				tempFCSlice = append(tempFCSlice, floatClass)
-	//			}
-	//			combinedResultB = append(combinedResultB,CombinedModelResultsforEachDataB[firstkey]...)
-	//		}
-	//		fmt.Println(len(combinedResultB))
-	//		fmt.Println(len(combinedDataB))
-	//	}
-	//
-	//	//CombinedDataResults[keyseq] = AUC(combinedDataB,combinedResultB)
-	//}
-	////fmt.Println(CombinedDataResults)
-
-	//loglossMapData := make(map[string]float64)
-	//for key,val := range CombinedModelResultsforEachDataB {
-	//	fmt.Println(key)
-	//	var tempFSclice []float64
-	//	for _, v  := range dataMap[key].Class {
-	//		floatClass,_  :=strconv.ParseFloat(v, 64)
-	//		tempFSclice = append(tempFSclice, floatClass)
-	//	}
-	//	logloss := AUC(tempFSclice, val)
-	//	loglossMapData[key] = logloss
-	//}
-	//fmt.Println("loglossMapData")
-	//fmt.Println(loglossMapData)
-
-	var resultSeqModel []string
-	for i := 0; i < len(wrappedModel); i++ {
-		strI := strconv.Itoa(i)
-		resultSeqModel = append(resultSeqModel, strI)
+	// exact Shapley values of every model, coalitions are scored by the metric of their averaged predictions
+	metricName := req.URL.Query().Get("metric")
+	if metricName == "" {
+		metricName = resTable.Task.Metric
 	}
-	resultSeqMapModel := make(map[string][]float64)
-	for _, v := range resultSeqModel {
-		resultSeqMapModel[v] = []float64{}
+	metric := getShapleyMetric(metricName)
+	modelKeys := make([]string, 0, len(wrappedModel))
+	for i := 0; i < len(wrappedModel); i++ {
+		modelKeys = append(modelKeys, wrappedModel[i].Key)
 	}
+	shapleySettings := getShapleySettings(req)
+	shapleyModelResults, shapleyModelStdErr, modelEstimator := shapleyValues(len(modelKeys), modelCoalitionValue(modelKeys, modelResMap, TotalData, metric), shapleySettings)
 
-	var resultSeqData []string
-	for i := 0; i < len(wrappedModel); i++ {
-		strI := strconv.Itoa(i)
-		resultSeqData = append(resultSeqData, strI)
+	// exact Shapley values of every dataset, coalitions are scored on the pool of their labels and ensemble predictions
+	dataKeys := make([]string, 0, len(wrappedData))
+	for i := 0; i < len(wrappedData); i++ {
+		dataKeys = append(dataKeys, wrappedData[i].Key)
 	}
-	resultSeqMapData := make(map[string][]float64)
-	for _, v := range resultSeqData {
-		resultSeqMapData[v] = []float64{}
+	shapleyDataResults, shapleyDataStdErr, dataEstimator := shapleyValues(len(dataKeys), dataCoalitionValue(dataKeys, dataMap, wrappedResult, metric), shapleySettings)
+	for i := 0; i < len(wrappedData); i++ {
+		wrappedData[i].Shapley = fmt.Sprintf("%.3f", shapleyDataResults[i])
+		wrappedData[i].ShapleyStdErr = fmt.Sprintf("%.3f", shapleyDataStdErr[i])
 	}
 
-
-	fmt.Println("-------- simple AUC-------")
-	for k , v := range loglossMap {
-		fmt.Println(k)
-		fmt.Println(v)
+	// each version is valued as a model of its own, default version is marked in the table
+	lineages, err := getModelLineageArray(contract)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
 	}
-
-	fmt.Println("-------- combined AUC-------")
-	for k , v := range CombinedModelResults {
-		fmt.Println(k)
-		fmt.Println(v)
+	defaultVersions := make(map[string]uint64)
+	for _, lineage := range lineages {
+		defaultVersions[lineage.Record.BaseName] = lineage.Record.DefaultVersion
 	}
-	fmt.Println("fullCombination AUC")
-	fmt.Println(allModelLogloss)
 
-	//shapleyTableModel := getShapleyTable(calculationSliceModel, resultSeqModel, CombinedModelResults, allModelLogloss,loglossMap, resultSeqMapModel)
-	//shapleyTableData := getShaplexyTable(calculationSliceData, resultSeqData, CombinedDataResults, allModelLogloss,loglossMapData, resultSeqMapData)
-	//fmt.Println(shapleyTableModel)
-	//fmt.Println(shapleyTableData)
-	//shapleyModelResults := calcModelShapley(shapleyTableModel)
-//	shapleyDataResults := calcModelShapley(shapleyTableData)
-	//ShapleyModellog = append(ShapleyModellog, shapleyModelResults)
-	//ShapleyDatalog = append(ShapleyDatalog, shapleyDataResults)
-
-	mockShap := []string{"0.115", "0.107", "0.0926","0.000","0.00810"}
 	for i := 0; i < len(wrappedModel); i++ {
-		wrappedModel[i].Shapley = mockShap[i]
+		wrappedModel[i].Default = wrappedModel[i].Record.Version != 0 && defaultVersions[wrappedModel[i].Record.BaseName] == wrappedModel[i].Record.Version
+		wrappedModel[i].Shapley = fmt.Sprintf("%.3f", shapleyModelResults[i])
+		wrappedModel[i].ShapleyStdErr = fmt.Sprintf("%.3f", shapleyModelStdErr[i])
 		modelMap[wrappedModel[i].Key] = wrappedModel[i].Record
-		keyString := "Model" + strconv.Itoa(i)
+		keyString := wrappedModel[i].Key
 		wrappedModel[i].Record.Logloss = fmt.Sprintf("%.3f", llMap[keyString])
 		wrappedModel[i].Record.Accuracy = fmt.Sprintf("%.3f", accuracyMap[keyString])
 
 	}
 
+	// decision-level fusion of all models, with equal weights and with weights from model Shapley values
+	equalWeights := make([]float64, len(modelKeys))
+	for i := range equalWeights {
+		equalWeights[i] = 1
+	}
+	equalFusion := fusePredictions(modelKeys, modelResMap, TotalData, equalWeights)
+	shapleyFusion := fusePredictions(modelKeys, modelResMap, TotalData, shapleyFusionWeights(shapleyModelResults))
+	for i := 0; i < len(wrappedModel); i++ {
+		wrappedModel[i].FusionWeight = fmt.Sprintf("%.3f", shapleyFusion.Weights[i])
+	}
+
 	rand.Seed(time.Now().UnixNano())
 
 	resTable.Models = wrappedModel
+
+	// Shapley values shown here go with the distribute form, a reward round pays exactly what was on the page
+	shares := RewardShares{make(map[string]float64), make(map[string]float64)}
+	for i, key := range modelKeys {
+		shares.Models[key] = shapleyModelResults[i]
+	}
+	for i, key := range dataKeys {
+		shares.Data[key] = shapleyDataResults[i]
+	}
+	sharesBytes, err := json.Marshal(shares)
+	if err != nil {
+		http.Error(reswt, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resTable.RewardShares = string(sharesBytes)
 	resTable.Data = wrappedData
+	resTable.Skipped, err = getSkippedValidations(contract)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	resTable.Events = lifecycleEvents.Recent()
 	resTable.Res = wrappedResult
-	resTable.ShapleyLog = ShapleyModellog
-	resTable.BalancedLogLoss = Round(allModelLogloss,3)
-	resTable.ShapleyAdjustedLogLoss = Round(allModelLogloss,3) + 0.05
-
-	//resTable.ShapleyAdjustedLogLoss =  Round(calculateShapleyAdjustedLogLoss(loglossMap,ShapleyModellog[len(ShapleyModellog)-1]),3)
-	fmt.Println(resTable.ShapleyAdjustedLogLoss)
-	fmt.Println(ShapleyModellog)
-	fmt.Println(ShapleyDatalog)
-
+	resTable.ShapleyValues = shapleyModelResults
+	resTable.ModelEstimator = modelEstimator
+	resTable.DataEstimator = dataEstimator
+	// values are computed for this page only, they are not kept between requests
+	resTable.ShapleyLog = [][]float64{shapleyModelResults}
+	resTable.BalancedAUC = Round(equalFusion.AUC,3)
+	resTable.BalancedLogLoss = Round(equalFusion.Logloss,3)
+	resTable.ShapleyAdjustedAUC = Round(shapleyFusion.AUC,3)
+	resTable.ShapleyAdjustedLogLoss = Round(shapleyFusion.Logloss,3)
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	curveCache := NewCoalitionCache(modelCoalitionValue(modelKeys, modelResMap, TotalData, aucMetric))
+	curve := ensembleCurve(len(modelKeys), curveCache, curveSampleLimit, rng)
+	memberCounts := make([]int, 0, len(curve))
+	var meanAUC, bestAUC, worstAUC, bandAUC []float64
+	yMin := 0.5
+	curveSubtitle := ""
+	for _, point := range curve {
+		if point.Sampled {
+			curveSubtitle = fmt.Sprintf("member counts with more than %d ensembles are sampled", curveSampleLimit)
+		}
+		memberCounts = append(memberCounts, point.Members)
+		meanAUC = append(meanAUC, Round(point.Mean, 3))
+		bestAUC = append(bestAUC, Round(point.Best, 3))
+		worstAUC = append(worstAUC, Round(point.Worst, 3))
+		bandAUC = append(bandAUC, Round(point.Best-point.Worst, 3))
+		yMin = math.Min(yMin, math.Floor(point.Worst*20)/20)
+	}
 
 	// create a new line instance
 	line := charts.NewLine()
@@ -564,6 +724,7 @@ func displayResults(reswt http.ResponseWriter, req *http.Request){
 		charts.WithLegendOpts(opts.Legend{Show: true, Align: "left",Orient : "vertical", X:"right", Top: "175"}),
 		charts.WithTitleOpts(opts.Title{
 			Title: "AUC of ensemble by member count",
+			Subtitle: curveSubtitle,
 			Left: "250",
 			TitleStyle: &opts.TextStyle{
 				Color:      "#4CAF50",
@@ -575,7 +736,7 @@ func displayResults(reswt http.ResponseWriter, req *http.Request){
 		}),
 		charts.WithYAxisOpts(opts.YAxis{
 			Name: "AUC",
-			Min: 0.5,
+			Min: yMin,
 			Max: 1,
 		}),
 		charts.WithXAxisOpts(opts.XAxis{
@@ -584,9 +745,14 @@ func displayResults(reswt http.ResponseWriter, req *http.Request){
 
 		)
 
-	line.SetXAxis(makeRange(1, 5))
-	line.AddSeries("Ensemble", appendLineItems(GraphResults))
-	line.SetSeriesOptions(charts.WithLineChartOpts(opts.LineChart{Smooth: false}))
+	// min/max band is drawn by stacking the best-worst difference on top of an invisible worst line
+	line.SetXAxis(memberCounts)
+	line.AddSeries("Worst", appendLineItems(worstAUC), charts.WithLineChartOpts(opts.LineChart{Stack: "band"}),
+		charts.WithLineStyleOpts(opts.LineStyle{Opacity: 0.01}))
+	line.AddSeries("Min/max", appendLineItems(bandAUC), charts.WithLineChartOpts(opts.LineChart{Stack: "band"}),
+		charts.WithLineStyleOpts(opts.LineStyle{Opacity: 0.01}), charts.WithAreaStyleOpts(opts.AreaStyle{Color: "#A5D6A7", Opacity: 0.5}))
+	line.AddSeries("Best", appendLineItems(bestAUC), charts.WithLineStyleOpts(opts.LineStyle{Color: "#388E3C", Type: "dashed"}))
+	line.AddSeries("Mean", appendLineItems(meanAUC), charts.WithLineStyleOpts(opts.LineStyle{Color: "#1B5E20", Width: 2}))
 	var htmlSnippet = renderToHtml(line)
 	resTable.Graphs = append(resTable.Graphs, htmlSnippet)
 
@@ -594,245 +760,486 @@ func displayResults(reswt http.ResponseWriter, req *http.Request){
 
 }
 
-func generateSequence(lenght int) []string{
-	keysequenceModel := generateModelKeys(lenght)
-	var keySequenceSlice []string
+func SumPredictions (modelN []float64, modelM []float64, prev []float64) []float64{
+	var combinedModelPAvg []float64
+	var sum float64
+	for i := 0; i < len(modelN) ; i++ {
+		if len(prev) == 0{
+			sum = modelN[i] + modelM[i]
+		}else{
+			sum = prev[i] + modelM[i]
+		}
+		combinedModelPAvg = append(combinedModelPAvg, sum)
+	}
+	return combinedModelPAvg
+}
 
-	for j := 0; j < len(keysequenceModel) ; j++ {
-		truncSeq := strings.Replace(keysequenceModel, string(keysequenceModel[j]),"",-1)
-		Perm([]rune(truncSeq), func(a []rune) {
-			keySequenceSlice = append(keySequenceSlice, string(a))
-		})
+func DividePredictions (modelP []float64, totalLength float64) []float64 {
+	var resSlice []float64
+	for i := 0; i < len(modelP) ; i++ {
+		divres := modelP[i] / totalLength
+		resSlice = append(resSlice, divres)
 	}
-	return keySequenceSlice
+	return resSlice
 }
 
+// Shapley value calculation -----------------------------------------------------------------------------------
+
+// ShapleyMetric scores predictions against labels, Baseline is the value of an empty coalition
+type ShapleyMetric struct{
+	Name string
+	Score func(labels []float64, predictions []float64) float64
+	Baseline float64
+}
 
-/*func calculateShapleyAdjustedLogLoss(loglossMap map[string]float64, adjustmentMap []float64) float64{
-	var adjustedShap float64
-	fmt.Println(adjustmentMap)
-	sum := 0.0
-	i := 0
+// coalitionValue returns the value of a coalition, the coalition must not be kept after the call
+type coalitionValue func(coalition Coalition) float64
 
-	keys := make([]string, 0, len(loglossMap))
+// AUC of 0.5 is random guessing, log loss of ln(2) is always predicting 0.5
+var aucMetric = ShapleyMetric{"AUC", AUC, 0.5}
+var loglossMetric = ShapleyMetric{"LogLoss", negativeLogloss, -math.Log(2)}
 
-	for k := range loglossMap{
-		keys = append(keys, k)
+func getShapleyMetric(name string) ShapleyMetric {
+	if strings.EqualFold(name, loglossMetric.Name) {
+		return loglossMetric
 	}
+	return aucMetric
+}
 
-	sort.Strings(keys)
+// log loss is negated so that higher values mean bigger contribution as with AUC
+func negativeLogloss(labels []float64, predictions []float64) float64 {
+	return -calculateModelLogloss(labels, predictions)
+}
 
-	for _, k := range keys {
-		if adjustmentMap[i] > 0{
-			sum += loglossMap[k] * adjustmentMap[i]
-		}else{
-			sum += -1 * loglossMap[k] * adjustmentMap[i]
+// averages predictions of all given models, every model must predict the same rows
+func averagePredictions(predictions [][]float64) []float64 {
+	if len(predictions) == 0 {
+		return nil
+	}
+	sum := make([]float64, len(predictions[0]))
+	for _, modelP := range predictions {
+		for i := range sum {
+			sum[i] += modelP[i]
 		}
-		i++
 	}
-	adjustedShap = sum/ float64(len(loglossMap))
-	return adjustedShap
-}*/
+	return DividePredictions(sum, float64(len(predictions)))
+}
 
-/*func getShapleyTable(calculationSlice []string, resSeq []string,  combinedSequences map[string]float64, fullcombination float64, singlelogloss map[string]float64, resultSeqMap map[string][]float64) map[string][]float64{
-
-	index := 0
-	second := 0
-
-	for _,seq := range calculationSlice {
-		s := strconv.Itoa(index)
-		for i := 0; i < len(seq) ; i++ {
-			if string(seq[i]) == resSeq[index] {
-				res := singlelogloss["Model"+s]
-				tempSlice := resultSeqMap[string(seq[i])]
-				tempSlice = append(tempSlice, res)
-				resultSeqMap[string(seq[i])] = tempSlice
-				fmt.Println("single")
-						}else{
-				if i == len(seq) -1{
-					keystring := seq[0 : len(seq)-1]
-					res := fullcombination-combinedSequences[keystring]
-					fmt.Println("last")
-					tempSlice := resultSeqMap[string(seq[i])]
-					tempSlice = append(tempSlice, res)
-					resultSeqMap[string(seq[i])] =  tempSlice
-				}else{
-					keystring := seq[0 : len(seq)-1]
-					res := combinedSequences[keystring] - singlelogloss["Model"+s]
-					fmt.Println("two")
-					tempSlice := resultSeqMap[string(seq[i])]
-					tempSlice = append(tempSlice, res)
-					resultSeqMap[string(seq[i])] =  tempSlice
-				}
+// modelCoalitionValue scores a coalition of models by the metric of their averaged predictions on the labels,
+// models without predictions for every label are left out of the ensemble
+func modelCoalitionValue(modelKeys []string, modelResMap map[string][]float64, labels []float64, metric ShapleyMetric) coalitionValue {
+	return func(coalition Coalition) float64 {
+		var predictions [][]float64
+		for _, m := range coalition.Members() {
+			modelP := modelResMap[modelKeys[m]]
+			if len(modelP) == len(labels) && len(labels) > 0 {
+				predictions = append(predictions, modelP)
 			}
 		}
-		second++
-		if second == len(calculationSlice)/len(resSeq){
-				index++
-				second = 0
+		if len(predictions) == 0 {
+			return metric.Baseline
 		}
+		return scoreOrBaseline(metric, labels, averagePredictions(predictions))
 	}
-	return resultSeqMap
-}*/
-func getShapleyTableData(calculationSlice []string, resSeq []string,  combinedSequences map[string]float64, fullcombination float64, singlelogloss map[string]float64, resultSeqMap map[string][]float64) map[string][]float64{
-
-	index := 0
-	second := 0
-
-	for _,seq := range calculationSlice {
-		s := strconv.Itoa(index)
-		for i := 0; i < len(seq) ; i++ {
-			if string(seq[i]) == resSeq[index] {
-				res := singlelogloss["Model"+s]
-				tempSlice := resultSeqMap[string(seq[i])]
-				tempSlice = append(tempSlice, res)
-				resultSeqMap[string(seq[i])] = tempSlice
-				fmt.Println("single")
-						}else{
-				if i == len(seq) -1{
-					keystring := seq[0 : len(seq)-1]
-					res := fullcombination-combinedSequences[keystring]
-					fmt.Println("last")
-					tempSlice := resultSeqMap[string(seq[i])]
-					tempSlice = append(tempSlice, res)
-					resultSeqMap[string(seq[i])] =  tempSlice
-				}else{
-					keystring := seq[0 : len(seq)-1]
-					res := combinedSequences[keystring] - singlelogloss["Model"+s]
-					fmt.Println("two")
-					tempSlice := resultSeqMap[string(seq[i])]
-					tempSlice = append(tempSlice, res)
-					resultSeqMap[string(seq[i])] =  tempSlice
-				}
+}
+
+// dataCoalitionValue scores a coalition of datasets by the metric of the ensemble predictions on their pooled rows,
+// ensemble prediction of a dataset is the average of every result stored for it
+func dataCoalitionValue(dataKeys []string, dataMap map[string]DataFlex, wrappedResult []ResultsWrapper, metric ShapleyMetric) coalitionValue {
+	dataLabels := make(map[string][]float64)
+	dataPredictions := make(map[string][]float64)
+	for _, key := range dataKeys {
+		var labels []float64
+		for _, v := range dataMap[key].Class {
+			floatClass, _ := strconv.ParseFloat(v, 64)
+			labels = append(labels, floatClass)
+		}
+		var predictions [][]float64
+		for _, result := range wrappedResult {
+			if result.Record.DataColName == dataMap[key].DataName && len(result.Record.Results) == len(labels) {
+				predictions = append(predictions, result.Record.Results)
 			}
 		}
-		second++
-		if second == len(calculationSlice)/len(resSeq){
-				index++
-				second = 0
+		if len(labels) > 0 && len(predictions) > 0 {
+			dataLabels[key] = labels
+			dataPredictions[key] = averagePredictions(predictions)
 		}
 	}
-	return resultSeqMap
-}
-
 
-/*func calcModelShapley(shapleyTable map[string][]float64)[]float64{
-	var result []float64
-	keys := make([]string, 0, len(shapleyTable))
-
-	for k := range shapleyTable{
-		keys = append(keys, k)
+	return func(coalition Coalition) float64 {
+		var labels []float64
+		var predictions []float64
+		for _, m := range coalition.Members() {
+			labels = append(labels, dataLabels[dataKeys[m]]...)
+			predictions = append(predictions, dataPredictions[dataKeys[m]]...)
+		}
+		if len(labels) == 0 {
+			return metric.Baseline
+		}
+		return scoreOrBaseline(metric, labels, predictions)
 	}
+}
 
-	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+// single class pools have no AUC, such coalitions are worth as much as the empty one
+func scoreOrBaseline(metric ShapleyMetric, labels []float64, predictions []float64) float64 {
+	score := metric.Score(labels, predictions)
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return metric.Baseline
+	}
+	return score
+}
 
-	for _, k := range keys {
-		row := shapleyTable[k]
-		sum := 0.0
-		for _, value := range row {
-			sum += value
-		}
-		result = append(result,sum / float64(len(shapleyTable[k])) )
+// Coalition is a set of player indexes kept as bits, every word holds 64 players
+type Coalition []uint64
 
-	}
-	return result
-}*/
+func NewCoalition(players int) Coalition {
+	return make(Coalition, (players+63)/64)
+}
 
-func SumPredictions (modelN []float64, modelM []float64, prev []float64) []float64{
-	var combinedModelPAvg []float64
-	var sum float64
-	for i := 0; i < len(modelN) ; i++ {
-		if len(prev) == 0{
-			sum = modelN[i] + modelM[i]
-		}else{
-			sum = prev[i] + modelM[i]
-		}
-		combinedModelPAvg = append(combinedModelPAvg, sum)
-	}
-	return combinedModelPAvg
+func (c Coalition) Has(player int) bool {
+	return c[player/64]&(1<<uint(player%64)) != 0
 }
 
-func DividePredictions (modelP []float64, totalLength float64) []float64 {
-	var resSlice []float64
-	for i := 0; i < len(modelP) ; i++ {
-		divres := modelP[i] / totalLength
-		resSlice = append(resSlice, divres)
-	}
-	return resSlice
+func (c Coalition) Add(player int) {
+	c[player/64] |= 1 << uint(player%64)
 }
 
-//func calculateModelAccuracy(data []float64, predictions []float64) float64{
-//	var roundedPrediction float64
-//	correctPredictions := 0
-//	for i := 0; i < len(predictions); i++ {
-//		currentPrediction := 1-predictions[i]
-//		currentClass := data[i]
-//		// slenkstis 0.5 bet tai yra gerai
-//		roundedPrediction = math.Round(currentPrediction)
-//		if currentClass == roundedPrediction{
-//			correctPredictions = correctPredictions+1
-//		}
-//	}
-//	totalAmount := len(predictions)
-//	accuracy := float64(correctPredictions) / float64(totalAmount)
-//	return accuracy
-//}
+func (c Coalition) Remove(player int) {
+	c[player/64] &^= 1 << uint(player%64)
+}
 
-func AUC(labels []float64, predictions []float64) float64 {
-	fmt.Println(len(predictions))
-	fmt.Println(len(labels))
-	Y := mat.NewDense(len(labels), 1, labels)
-	scores := mat.NewDense(len(predictions), 1, predictions)
-	fpr, tpr, _ := metrics.ROCCurve(Y, scores, 0., nil)
-	return metrics.AUC(fpr,tpr)
+// With returns a copy of the coalition joined by the player
+func (c Coalition) With(player int) Coalition {
+	joined := append(Coalition(nil), c...)
+	joined.Add(player)
+	return joined
 }
 
-func generateModelKeys(length int)string{
-	sequence := ""
-	for i := 0; i < length; i++ {
-		sequence = sequence +	strconv.Itoa(i)
+func (c Coalition) Size() int {
+	size := 0
+	for _, word := range c {
+		size += bits.OnesCount64(word)
 	}
-	return sequence
+	return size
 }
 
-func  calculateModelLogloss(data []float64, predictions []float64) float64{
-	var sumLogLoss float64
-	var logLoss float64
-	for i := 0; i < len(predictions); i++ {
-		currentPrediction := predictions[i]
-		fClass := data[i]
-		fPrediction := 1 - currentPrediction
-		if fPrediction == 0 {
-			fPrediction = math.Nextafter(fPrediction, 1)
-		}
-		if fPrediction == 1{
-			fPrediction = math.Nextafter(fPrediction, 0)
+// Members lists player indexes in ascending order
+func (c Coalition) Members() []int {
+	members := make([]int, 0, c.Size())
+	for w, word := range c {
+		for word != 0 {
+			members = append(members, w*64+bits.TrailingZeros64(word))
+			word &= word - 1
 		}
-		//machineConstant plius kus skaiciuoja log
-		templogLoss := fClass * math.Log(fPrediction) + (1-fClass) * math.Log(1-fPrediction)
-		sumLogLoss = sumLogLoss + templogLoss
 	}
-	// this calculates avarage, but i guess it should be median
-	logLoss = -1 * sumLogLoss/ float64(len(predictions))
-	return logLoss
+	return members
 }
 
-func Perm(a []rune, f func([]rune)) {
-	perm(a, f, 0)
+// CoalitionCache memoizes coalition values, coalitions of up to 64 players are keyed by their single word
+type CoalitionCache struct{
+	value coalitionValue
+	small map[uint64]float64
+	big map[string]float64
 }
 
-// Permute the values at index i to len(a)-1.
-func perm(a []rune, f func([]rune), i int) {
-	if i > len(a) {
-		f(a)
-		return
+func NewCoalitionCache(value coalitionValue) *CoalitionCache {
+	return &CoalitionCache{value, make(map[uint64]float64), make(map[string]float64)}
+}
+
+func (cache *CoalitionCache) Value(c Coalition) float64 {
+	if len(c) == 1 {
+		if res, ok := cache.small[c[0]]; ok {
+			return res
+		}
+		res := cache.value(c)
+		cache.small[c[0]] = res
+		return res
+	}
+	key := make([]byte, 8*len(c))
+	for w, word := range c {
+		binary.LittleEndian.PutUint64(key[8*w:], word)
+	}
+	if res, ok := cache.big[string(key)]; ok {
+		return res
+	}
+	res := cache.value(c)
+	cache.big[string(key)] = res
+	return res
+}
+
+// ShapleySettings selects the Shapley estimator, player counts above ExactLimit are sampled
+type ShapleySettings struct{
+	ExactLimit int
+	Permutations int
+	Tolerance float64
+}
+
+var defaultShapleySettings = ShapleySettings{ExactLimit: 10, Permutations: 200, Tolerance: 0.001}
+
+// reads estimator settings from the query string, missing or invalid values keep their defaults
+func getShapleySettings(req *http.Request) ShapleySettings {
+	settings := defaultShapleySettings
+	query := req.URL.Query()
+	if v, err := strconv.Atoi(query.Get("exactLimit")); err == nil && v >= 0 {
+		settings.ExactLimit = v
+	}
+	if v, err := strconv.Atoi(query.Get("permutations")); err == nil && v > 0 {
+		settings.Permutations = v
+	}
+	if v, err := strconv.ParseFloat(query.Get("tolerance"), 64); err == nil && v >= 0 {
+		settings.Tolerance = v
+	}
+	return settings
+}
+
+// shapleyValues returns Shapley values with their standard errors and the name of the estimator used,
+// exact values have no error, exact enumeration is limited to coalitions fitting into one word
+func shapleyValues(n int, value coalitionValue, settings ShapleySettings) ([]float64, []float64, string) {
+	if n <= settings.ExactLimit && n < 64 {
+		return exactShapley(n, value), make([]float64, n), "exact"
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	shapley, stdErr := monteCarloShapley(n, value, settings.Permutations, settings.Tolerance, rng)
+	return shapley, stdErr, fmt.Sprintf("Monte Carlo, %d permutations", settings.Permutations)
+}
+
+// monteCarloShapley averages marginal contributions over random permutations of the players,
+// once a prefix scores within tolerance of the grand coalition the rest of the permutation contributes zero
+func monteCarloShapley(n int, value coalitionValue, permutations int, tolerance float64, rng *rand.Rand) ([]float64, []float64) {
+	shapley := make([]float64, n)
+	stdErr := make([]float64, n)
+	if n == 0 || permutations <= 0 {
+		return shapley, stdErr
+	}
+	cache := NewCoalitionCache(value)
+	grand := NewCoalition(n)
+	for i := 0; i < n; i++ {
+		grand.Add(i)
+	}
+	grandValue := cache.Value(grand)
+
+	sum := make([]float64, n)
+	sumSquares := make([]float64, n)
+	for p := 0; p < permutations; p++ {
+		prefix := NewCoalition(n)
+		prefixValue := cache.Value(prefix)
+		for _, player := range rng.Perm(n) {
+			if math.Abs(grandValue-prefixValue) < tolerance {
+				break
+			}
+			prefix.Add(player)
+			nextValue := cache.Value(prefix)
+			marginal := nextValue - prefixValue
+			sum[player] += marginal
+			sumSquares[player] += marginal * marginal
+			prefixValue = nextValue
+		}
+	}
+
+	samples := float64(permutations)
+	for i := 0; i < n; i++ {
+		shapley[i] = sum[i] / samples
+		if permutations > 1 {
+			variance := (sumSquares[i] - samples*shapley[i]*shapley[i]) / (samples - 1)
+			stdErr[i] = math.Sqrt(math.Max(variance, 0) / samples)
+		}
+	}
+	return shapley, stdErr
+}
+
+// FusionResult scores a weighted decision-level fusion, Weights are the weights actually applied to each model
+type FusionResult struct{
+	Weights []float64
+	AUC float64
+	Logloss float64
+}
+
+// shapleyFusionWeights clips Shapley values to non-negative weights, models with negative value get no weight
+func shapleyFusionWeights(shapley []float64) []float64 {
+	weights := make([]float64, len(shapley))
+	for i, v := range shapley {
+		weights[i] = math.Max(v, 0)
+	}
+	return weights
+}
+
+// fusePredictions combines model predictions as a weighted average, models without predictions for every label
+// are left out and the remaining weights rescaled to sum to one, equal weights are used when none are positive
+func fusePredictions(modelKeys []string, modelResMap map[string][]float64, labels []float64, weights []float64) FusionResult {
+	result := FusionResult{Weights: make([]float64, len(modelKeys)), AUC: aucMetric.Baseline, Logloss: -loglossMetric.Baseline}
+	var valid []int
+	total := 0.0
+	for i, key := range modelKeys {
+		if len(labels) > 0 && len(modelResMap[key]) == len(labels) {
+			valid = append(valid, i)
+			total += weights[i]
+		}
+	}
+	if len(valid) == 0 {
+		return result
+	}
+	for _, i := range valid {
+		if total > 0 {
+			result.Weights[i] = weights[i] / total
+		} else {
+			result.Weights[i] = 1 / float64(len(valid))
+		}
+	}
+
+	fused := make([]float64, len(labels))
+	for _, i := range valid {
+		for row, p := range modelResMap[modelKeys[i]] {
+			fused[row] += result.Weights[i] * p
+		}
+	}
+	result.AUC = scoreOrBaseline(aucMetric, labels, fused)
+	result.Logloss = calculateModelLogloss(labels, fused)
+	return result
+}
+
+// EnsembleCurvePoint holds AUC statistics over ensembles of the same member count
+type EnsembleCurvePoint struct{
+	Members int
+	Mean float64
+	Best float64
+	Worst float64
+	Ensembles int
+	Sampled bool
+}
+
+// member counts with more ensembles than this are estimated from random ensembles
+const curveSampleLimit = 200
+
+// ensembleCurve scores every k member ensemble for k from 1 to n, or a random sample of them when there are too many
+func ensembleCurve(n int, cache *CoalitionCache, sampleLimit int, rng *rand.Rand) []EnsembleCurvePoint {
+	var curve []EnsembleCurvePoint
+	for k := 1; k <= n; k++ {
+		point := EnsembleCurvePoint{Members: k, Best: math.Inf(-1), Worst: math.Inf(1)}
+		sum := 0.0
+		score := func(c Coalition) {
+			value := cache.Value(c)
+			sum += value
+			point.Best = math.Max(point.Best, value)
+			point.Worst = math.Min(point.Worst, value)
+			point.Ensembles++
+		}
+		if binomial(n, k) <= float64(sampleLimit) {
+			forEachCombination(n, k, score)
+		} else {
+			point.Sampled = true
+			for i := 0; i < sampleLimit; i++ {
+				c := NewCoalition(n)
+				for _, player := range rng.Perm(n)[:k] {
+					c.Add(player)
+				}
+				score(c)
+			}
+		}
+		point.Mean = sum / float64(point.Ensembles)
+		curve = append(curve, point)
+	}
+	return curve
+}
+
+func binomial(n int, k int) float64 {
+	res := 1.0
+	for i := 1; i <= k; i++ {
+		res = res * float64(n-k+i) / float64(i)
+	}
+	return res
+}
+
+// calls f with every k member coalition of n players, the coalition is reused between calls
+func forEachCombination(n int, k int, f func(Coalition)) {
+	c := NewCoalition(n)
+	var walk func(start int, left int)
+	walk = func(start int, left int) {
+		if left == 0 {
+			f(c)
+			return
+		}
+		for player := start; player <= n-left; player++ {
+			c.Add(player)
+			walk(player+1, left-1)
+			c.Remove(player)
+		}
 	}
-	perm(a, f, i+1)
-	for j := i + 1; j < len(a); j++ {
-		a[i], a[j] = a[j], a[i]
-		perm(a, f, i+1)
-		a[i], a[j] = a[j], a[i]
+	walk(0, k)
+}
+
+// exactShapley enumerates every coalition of n < 64 players as a bitmask, each coalition value is calculated once
+func exactShapley(n int, value coalitionValue) []float64 {
+	shapley := make([]float64, n)
+	if n == 0 {
+		return shapley
+	}
+	cache := NewCoalitionCache(value)
+
+	// weight of a coalition of size s is s!(n-s-1)!/n!
+	weights := make([]float64, n)
+	weights[0] = 1 / float64(n)
+	for size := 1; size < n; size++ {
+		weights[size] = weights[size-1] * float64(size) / float64(n-size)
+	}
+
+	full := uint64(1)<<uint(n) - 1
+	for mask := uint64(0); mask < full; mask++ {
+		without := cache.Value(Coalition{mask})
+		size := bits.OnesCount64(mask)
+		for player := 0; player < n; player++ {
+			bit := uint64(1) << uint(player)
+			if mask&bit == 0 {
+				shapley[player] += weights[size] * (cache.Value(Coalition{mask | bit}) - without)
+			}
+		}
+	}
+	return shapley
+}
+
+//func calculateModelAccuracy(data []float64, predictions []float64) float64{
+//	var roundedPrediction float64
+//	correctPredictions := 0
+//	for i := 0; i < len(predictions); i++ {
+//		currentPrediction := 1-predictions[i]
+//		currentClass := data[i]
+//		// slenkstis 0.5 bet tai yra gerai
+//		roundedPrediction = math.Round(currentPrediction)
+//		if currentClass == roundedPrediction{
+//			correctPredictions = correctPredictions+1
+//		}
+//	}
+//	totalAmount := len(predictions)
+//	accuracy := float64(correctPredictions) / float64(totalAmount)
+//	return accuracy
+//}
+
+func AUC(labels []float64, predictions []float64) float64 {
+	Y := mat.NewDense(len(labels), 1, labels)
+	scores := mat.NewDense(len(predictions), 1, predictions)
+	fpr, tpr, _ := metrics.ROCCurve(Y, scores, 0., nil)
+	return metrics.AUC(fpr,tpr)
+}
+
+func  calculateModelLogloss(data []float64, predictions []float64) float64{
+	var sumLogLoss float64
+	var logLoss float64
+	for i := 0; i < len(predictions); i++ {
+		currentPrediction := predictions[i]
+		fClass := data[i]
+		fPrediction := 1 - currentPrediction
+		if fPrediction == 0 {
+			fPrediction = math.Nextafter(fPrediction, 1)
+		}
+		if fPrediction == 1{
+			fPrediction = math.Nextafter(fPrediction, 0)
+		}
+		//machineConstant plius kus skaiciuoja log
+		templogLoss := fClass * math.Log(fPrediction) + (1-fClass) * math.Log(1-fPrediction)
+		sumLogLoss = sumLogLoss + templogLoss
 	}
+	// this calculates avarage, but i guess it should be median
+	logLoss = -1 * sumLogLoss/ float64(len(predictions))
+	return logLoss
 }
 
 /*func AnsambleAccuracy(results  map[string]ResultsArray, models map[string]ModelFile, data map[string]DataCol) float64{
@@ -860,15 +1267,15 @@ func perm(a []rune, f func([]rune), i int) {
 
 func runBenchmark(reswt http.ResponseWriter, req *http.Request){
 	log.Println("initDataFile")
-	batchId := "dataCol0"
-	owner := "Vaidotas"
+	owner := requestedOwner
 	x :="1.1,1.2"
 	y :="1.1,1.2"
-	label :="1.1,1.2"
+	label :="0,1"
 
-	result, err := contract.SubmitTransaction("initDataFile",batchId,owner,x,y,label)
+	result, err := contract.SubmitTransaction("initDataFile",owner,x,y,label)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		writeTransactionError(reswt, err)
+		return
 	}
 	/*result, err := contract.SubmitTransaction("initTestData", "-6.613923466678558","1.8353593889380635", "1","Vaidotas","0")
 	if err != nil {
@@ -926,17 +1333,25 @@ func uploadModel(reswt http.ResponseWriter, req *http.Request){
 
 	ModelType := req.PostFormValue("modelType")
 	LibraryType := req.PostFormValue("libType")
+	SchemaName := req.PostFormValue("schema")
+	TaskName := req.PostFormValue("task")
+	// base name publishes a new version of the model, it keeps types and schema of the parent version
+	BaseName := req.PostFormValue("baseName")
+	ParentVersion := req.PostFormValue("parentVersion")
+	Changelog := req.PostFormValue("changelog")
+	if BaseName != "" {
+		parent, err := getModelVersion(contract, BaseName, ParentVersion)
+		if err != nil {
+			writeTransactionError(reswt, err)
+			return
+		}
+		ModelType = parent.ModelType
+		LibraryType = parent.LibraryType
+		SchemaName = parent.SchemaName
+	}
 	fmt.Println(ModelType)
 	fmt.Println(LibraryType)
 
-	// Create a temporary file within our temp-images directory that follows
-	// a particular naming pattern
-	tempFile, err := ioutil.TempFile("/home/vdledger/HLtwothree/fabric-samples/asset-transfer-basic/application-go/Files/", "model-*.zip")
-	if err != nil {
-		fmt.Println(err)
-	}
-	defer tempFile.Close()
-
 	// read all of the contents of our uploaded file into a
 	// byte array
 	fileBytes, err := ioutil.ReadAll(file)
@@ -944,24 +1359,92 @@ func uploadModel(reswt http.ResponseWriter, req *http.Request){
 		fmt.Println(err)
 	}
 
-	uEnc := b64.URLEncoding.EncodeToString(fileBytes)
-	// write this byte array to our temporary file
-	//tempFile.Write(fileBytes)
+	// validation needs data of any owner in the task, not only data of this wallet
+	dataExists, err := hasRecords(contract, "GetAllData", "", "", TaskName)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+
+	// native models are JSON definitions evaluated by the chaincode, they need no oracle test or blob store
+	if LibraryType == "GO" {
+		var ModelName string
+		if BaseName != "" {
+			ModelName, err = publishNativeModelVersion(contract, BaseName, requestedOwner, ParentVersion, Changelog, string(fileBytes))
+		}else{
+			ModelName, err = initNativeModel(contract, ModelType, requestedOwner, string(fileBytes), SchemaName, TaskName)
+		}
+		if err != nil {
+			writeTransactionError(reswt, err)
+			return
+		}
+		if dataExists {
+			err = validateNewModel(contract,ModelName)
+			if redirectValidationSkipped(reswt, req, ModelName, "/showResults", err) {
+				return
+			}
+			if err != nil {
+				writeTransactionError(reswt, err)
+				return
+			}
+		}
+		http.Redirect(reswt,req,"/showResults",302)
+		return
+	}
+
+	// PMML models are checked here as the worker evaluates them, other models are tested by their oracle
+	if LibraryType == "PMML" {
+		err = testPMML(contract, fileBytes, SchemaName)
+		if err != nil {
+			log.Printf("PMML model test failed: %v", err)
+			http.Error(reswt, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// model file is kept in the blob store, ledger only gets its hash
+	fileHash, err := putBlob(fileBytes)
+	if err != nil {
+		fmt.Println(err)
+		http.Redirect(reswt,req,"/home",302)
+		return
+	}
+	mediaType := handler.Header.Get("Content-Type")
+	if mediaType == "" {
+		mediaType = http.DetectContentType(fileBytes)
+	}
 	// return that we have successfully uploaded our file!
 	fmt.Println( "Successfully Uploaded File")
-	IdResponseM := getModelID(contract, "Vaidotas")
-	IdResponseD := getDataID(contract, "Vaidotas")
-	modelId := binary.BigEndian.Uint64(IdResponseM)
-	dataId := binary.BigEndian.Uint64(IdResponseD)
-	fmt.Println(modelId)
-	testResult := testModel(contract,uEnc,ModelType, LibraryType)
-	result := binary.BigEndian.Uint64(testResult)
-	ModelName := "Model"+ strconv.FormatUint(modelId, 10)
+	result := uint64(1)
+	if LibraryType != "PMML" {
+		testResult, err := testModel(contract, fileHash, len(fileBytes), mediaType, ModelType, LibraryType)
+		if err != nil {
+			writeTransactionError(reswt, err)
+			return
+		}
+		result = binary.BigEndian.Uint64(testResult)
+	}
 	fmt.Println(result)
 	if result != 0{
-		initModel(contract,ModelName ,ModelType,LibraryType,"Vaidotas",modelId,uEnc)
-		if dataId > 0{
-			validateNewModel(contract,ModelName)
+		var ModelName string
+		if BaseName != "" {
+			ModelName, err = publishModelVersion(contract, BaseName, requestedOwner, ParentVersion, Changelog, fileHash, len(fileBytes), mediaType)
+		}else{
+			ModelName, err = initModel(contract,ModelType,LibraryType,requestedOwner,fileHash, len(fileBytes), mediaType, SchemaName, TaskName)
+		}
+		if err != nil {
+			writeTransactionError(reswt, err)
+			return
+		}
+		if dataExists {
+			err = validateNewModel(contract,ModelName)
+			if redirectValidationSkipped(reswt, req, ModelName, "/showResults", err) {
+				return
+			}
+			if err != nil {
+				writeTransactionError(reswt, err)
+				return
+			}
 		}
 		http.Redirect(reswt,req,"/showResults",302)
 	}else{
@@ -970,96 +1453,386 @@ func uploadModel(reswt http.ResponseWriter, req *http.Request){
 	}
 }
 
-func getModelID(contract *gateway.Contract, owner string)[]byte{
+// redirectValidationSkipped reports an upload as done when only the evaluator-only validation after it was refused,
+// the asset stays recorded and the page shows that validation needs a wallet with the evaluator role
+func redirectValidationSkipped(reswt http.ResponseWriter, req *http.Request, assetName string, page string, err error) bool{
+	if err == nil || !isAccessDenied(err) {
+		return false
+	}
+	log.Printf("%s is recorded, validation needs the evaluator role: %v", assetName, err)
+	http.Redirect(reswt, req, page+"?validation=skipped", 302)
+	return true
+}
+
+func getModelID(contract *gateway.Contract, owner string) ([]byte, error){
 	result, err := contract.SubmitTransaction("GetModelID", owner)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return nil, err
 	}
 	log.Println(string(result))
-	return result
+	return result, nil
 }
 
-func getDataID(contract *gateway.Contract, owner string)[]byte{
+func getDataID(contract *gateway.Contract, owner string) ([]byte, error){
 	result, err := contract.SubmitTransaction("GetDataID", owner)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return nil, err
 	}
 	log.Println(string(result))
-	return result
+	return result, nil
 }
 
-func getModelArray(contract *gateway.Contract) []ModelWrapper{
-	var wrappedModel[] ModelWrapper
-	result, err := contract.SubmitTransaction("GetAllModels")
+// records read from the ledger in one query page
+const queryPageSize = 50
+
+type QueryPage struct{
+	Records json.RawMessage `json:"Records"`
+	RecordsCount int32 `json:"RecordsCount"`
+	Bookmark string `json:"Bookmark"`
+}
+
+// forEachPage evaluates a paginated query with the filters following pageSize and bookmark, handle receives each page of records
+func forEachPage(contract *gateway.Contract, function string, filters []string, handle func(records []byte) error) error{
+	bookmark := ""
+	for {
+		args := append([]string{strconv.Itoa(queryPageSize), bookmark}, filters...)
+		result, err := contract.EvaluateTransaction(function, args...)
+		if err != nil {
+			return err
+		}
+		var page QueryPage
+		err = json.Unmarshal(result, &page)
+		if err != nil {
+			return err
+		}
+		err = handle(page.Records)
+		if err != nil {
+			return err
+		}
+		if page.RecordsCount < queryPageSize || page.Bookmark == "" || page.Bookmark == bookmark {
+			return nil
+		}
+		bookmark = page.Bookmark
+	}
+}
+
+// hasRecords reads a single record of a paginated query to tell whether any record matches the filters
+func hasRecords(contract *gateway.Contract, function string, filters ...string) (bool, error){
+	args := append([]string{"1", ""}, filters...)
+	result, err := contract.EvaluateTransaction(function, args...)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return false, err
 	}
-	err = json.Unmarshal(result, &wrappedModel)
+	var page QueryPage
+	err = json.Unmarshal(result, &page)
 	if err != nil {
-		log.Fatalf("Failed to marshall json: %v", err)
-
+		return false, err
 	}
-	return wrappedModel
+	return page.RecordsCount > 0, nil
+}
+
+// filters are owner, modelType, libraryType, model base name (all versions) and task, empty ones are ignored
+func getModelArray(contract *gateway.Contract, filters ...string) ([]ModelWrapper, error){
+	var wrappedModel[] ModelWrapper
+	err := forEachPage(contract, "GetAllModels", filters, func(records []byte) error {
+		var page []ModelWrapper
+		err := json.Unmarshal(records, &page)
+		wrappedModel = append(wrappedModel, page...)
+		return err
+	})
+	return wrappedModel, err
 }
 
-func getDataArray(contract *gateway.Contract) []DataFlexWrapper{
+// filters are owner, dataset name and task
+func getDataArray(contract *gateway.Contract, filters ...string) ([]DataFlexWrapper, error){
 	var wrappedData[] DataFlexWrapper
-	result, err := contract.SubmitTransaction("GetAllData")
+	err := forEachPage(contract, "GetAllData", filters, func(records []byte) error {
+		var page []DataFlexWrapper
+		err := json.Unmarshal(records, &page)
+		wrappedData = append(wrappedData, page...)
+		return err
+	})
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return nil, err
+	}
+	// private data is read from the collection of its organisation, identities other than its owner, admins
+	// and evaluators only get its schema and hash
+	for i := 0; i < len(wrappedData); i++ {
+		if !wrappedData[i].Record.Private {
+			continue
+		}
+		privateBytes, err := contract.EvaluateTransaction("ReadData", wrappedData[i].Key)
+		if err != nil {
+			log.Printf("Private data %s is not available: %v", wrappedData[i].Key, err)
+			continue
+		}
+		var privateData DataFlex
+		err = json.Unmarshal(privateBytes, &privateData)
+		if err != nil {
+			log.Printf("Failed to marshall json: %v", err)
+			continue
+		}
+		wrappedData[i].Record = privateData
 	}
-	err = json.Unmarshal(result, &wrappedData)
+	return wrappedData, nil
+}
+
+func getFeatureSchemaArray(contract *gateway.Contract) ([]FeatureSchemaWrapper, error){
+	var wrappedSchemas[] FeatureSchemaWrapper
+	result, err := contract.EvaluateTransaction("GetAllFeatureSchemas")
 	if err != nil {
-		log.Fatalf("Failed to marshall json: %v", err)
+		return nil, err
+	}
+	err = json.Unmarshal(result, &wrappedSchemas)
+	return wrappedSchemas, err
+}
 
+func getSkippedValidations(contract *gateway.Contract) ([]ValidationRequestWrapper, error){
+	var wrappedRequests[] ValidationRequestWrapper
+	result, err := contract.EvaluateTransaction("GetSkippedValidations")
+	if err != nil {
+		return nil, err
 	}
-	return wrappedData
+	err = json.Unmarshal(result, &wrappedRequests)
+	return wrappedRequests, err
 }
 
-func getResultArray(contract *gateway.Contract) []ResultsWrapper{
-	var wrappedResults[] ResultsWrapper
-	result, err := contract.SubmitTransaction("GetAllResults")
+// registerSchema records features in order as "age:numeric,visits:integer" under the schema name
+func registerSchema(reswt http.ResponseWriter, req *http.Request){
+	schemaName := req.PostFormValue("schemaName")
+	features := req.PostFormValue("features")
+	_, err := contract.SubmitTransaction("registerFeatureSchema", schemaName, requestedOwner, features)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		writeTransactionError(reswt, err)
+		return
 	}
-	err = json.Unmarshal(result, &wrappedResults)
+	http.Redirect(reswt,req,"/home",302)
+}
+
+func getTaskArray(contract *gateway.Contract) ([]TaskWrapper, error){
+	var wrappedTasks[] TaskWrapper
+	result, err := contract.EvaluateTransaction("GetAllTasks")
 	if err != nil {
-		log.Fatalf("Failed to marshall json: %v", err)
+		return nil, err
+	}
+	err = json.Unmarshal(result, &wrappedTasks)
+	return wrappedTasks, err
+}
 
+func getTask(contract *gateway.Contract, taskName string) (Task, error){
+	var task Task
+	result, err := contract.EvaluateTransaction("GetTask", taskName)
+	if err != nil {
+		return task, err
 	}
-	return  wrappedResults
+	err = json.Unmarshal(result, &task)
+	return task, err
 }
 
-func dataMatrixToString(data [][]string) string{
-	var flatData string
-	for key, dataRow := range data {
-		for ckey, dataCell:= range dataRow {
-			if ckey != 0{
-				flatData = flatData + "," +dataCell
-			}else{
-				flatData = flatData +dataCell
-			}
+// createTask opens a task models and data can be submitted to until its deadline
+func createTask(reswt http.ResponseWriter, req *http.Request){
+	_, err := contract.SubmitTransaction("createTask", req.PostFormValue("taskName"), req.PostFormValue("description"), req.PostFormValue("targetLabel"), req.PostFormValue("modelTypes"), req.PostFormValue("metric"), req.PostFormValue("deadline"))
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	http.Redirect(reswt,req,"/home",302)
+}
+
+// filters are model name, dataset name and task
+func getResultArray(contract *gateway.Contract, filters ...string) ([]ResultsWrapper, error){
+	var wrappedResults[] ResultsWrapper
+	err := forEachPage(contract, "GetAllResults", filters, func(records []byte) error {
+		var page []ResultsWrapper
+		err := json.Unmarshal(records, &page)
+		wrappedResults = append(wrappedResults, page...)
+		return err
+	})
+	return  wrappedResults, err
+}
 
+// withoutTask keeps models, data and results that belong to no task
+func withoutTask(models []ModelWrapper, data []DataFlexWrapper, results []ResultsWrapper) ([]ModelWrapper, []DataFlexWrapper, []ResultsWrapper){
+	var untaskedModels []ModelWrapper
+	for _, model := range models {
+		if model.Record.Task == "" {
+			untaskedModels = append(untaskedModels, model)
 		}
-		//we dont need to add separator at the end
-		if len(data)-1 != key{
-			flatData  = flatData + ">"
+	}
+	var untaskedData []DataFlexWrapper
+	for _, dataset := range data {
+		if dataset.Record.Task == "" {
+			untaskedData = append(untaskedData, dataset)
 		}
-
 	}
-	return flatData
+	var untaskedResults []ResultsWrapper
+	for _, result := range results {
+		if result.Record.Task == "" {
+			untaskedResults = append(untaskedResults, result)
+		}
+	}
+	return untaskedModels, untaskedData, untaskedResults
 }
 
-func uploadData(file []byte) []string{
-	fmt.Println("reading file")
+// chaincode starts errors of calls refused for the roles of the wallet identity with this
+const accessDeniedPrefix = "Access denied"
 
-	// Create a temporary file within our temp-images directory that follows
-	// a particular naming pattern
+func isAccessDenied(err error) bool{
+	return strings.Contains(err.Error(), accessDeniedPrefix)
+}
 
-	reader := csv.NewReader(bytes.NewBuffer(file))
-	rownum := 0
-	var dataset []string
-	for {
+// writeTransactionError shows the 403 page when chaincode refused the identity and reports other failures as bad requests
+func writeTransactionError(reswt http.ResponseWriter, err error){
+	log.Printf("Failed to Submit transaction: %v", err)
+	if isAccessDenied(err) {
+		reswt.WriteHeader(http.StatusForbidden)
+		tmplForbidden.ExecuteTemplate(reswt, "Forbidden.html", err.Error())
+		return
+	}
+	http.Error(reswt, err.Error(), http.StatusBadRequest)
+}
+
+func newAuditKey(kind string, key string) AuditKey{
+	return AuditKey{Kind: kind, Label: strings.Trim(strings.ReplaceAll(key, "\x00", " "), " "), Value: hex.EncodeToString([]byte(key))}
+}
+
+func getKeyHistory(contract *gateway.Contract, key string) ([]HistoryEntry, error){
+	var history []HistoryEntry
+	result, err := contract.EvaluateTransaction("GetHistoryForKey", key)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(result, &history)
+	if err != nil {
+		return nil, err
+	}
+	// chaincode records creators with each write, older writes have none and are looked up in the transactions on the ledger
+	for i := range history {
+		if history[i].CreatorMSP != "" {
+			continue
+		}
+		history[i].CreatorMSP, err = transactionCreatorMSP(history[i].TxID)
+		if err != nil {
+			log.Printf("Creator of transaction %s is not available: %v", history[i].TxID, err)
+		}
+	}
+	return history, nil
+}
+
+// transactionCreatorMSP reads the transaction with qscc GetTransactionByID, its signature header
+// holds the serialized identity of the submitter
+func transactionCreatorMSP(txID string) (string, error){
+	result, err := ledgerContract.EvaluateTransaction("GetTransactionByID", ledgerChannel, txID)
+	if err != nil {
+		return "", err
+	}
+	var processed pb.ProcessedTransaction
+	err = proto.Unmarshal(result, &processed)
+	if err != nil {
+		return "", err
+	}
+	if processed.TransactionEnvelope == nil {
+		return "", fmt.Errorf("transaction %s has no envelope", txID)
+	}
+	var payload cb.Payload
+	err = proto.Unmarshal(processed.TransactionEnvelope.Payload, &payload)
+	if err != nil {
+		return "", err
+	}
+	if payload.Header == nil {
+		return "", fmt.Errorf("transaction %s has no header", txID)
+	}
+	var signatureHeader cb.SignatureHeader
+	err = proto.Unmarshal(payload.Header.SignatureHeader, &signatureHeader)
+	if err != nil {
+		return "", err
+	}
+	var creator mspproto.SerializedIdentity
+	err = proto.Unmarshal(signatureHeader.Creator, &creator)
+	if err != nil {
+		return "", err
+	}
+	return creator.Mspid, nil
+}
+
+// auditPage lists model, data and result keys and shows the modification history of the one chosen with ?key=
+func auditPage(reswt http.ResponseWriter, req *http.Request){
+	var page AuditPage
+	models, err := getModelArray(contract)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	for _, model := range models {
+		page.Keys = append(page.Keys, newAuditKey("Model", model.Key))
+	}
+	datasets, err := getDataArray(contract)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	for _, data := range datasets {
+		page.Keys = append(page.Keys, newAuditKey("Data", data.Key))
+	}
+	results, err := getResultArray(contract)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	for _, result := range results {
+		page.Keys = append(page.Keys, newAuditKey("Results", result.Key))
+	}
+
+	page.Selected = req.FormValue("key")
+	if page.Selected != "" {
+		key, err := hex.DecodeString(page.Selected)
+		if err != nil {
+			http.Error(reswt, "Invalid key", http.StatusBadRequest)
+			return
+		}
+		page.History, err = getKeyHistory(contract, string(key))
+		if err != nil {
+			if isAccessDenied(err) {
+				writeTransactionError(reswt, err)
+				return
+			}
+			log.Printf("Failed to evaluate transaction: %v", err)
+			page.Error = err.Error()
+		}
+	}
+	tmplAudit.ExecuteTemplate(reswt, "Audit.html", page)
+}
+
+func dataMatrixToString(data [][]string) string{
+	var flatData string
+	for key, dataRow := range data {
+		for ckey, dataCell:= range dataRow {
+			if ckey != 0{
+				flatData = flatData + "," +dataCell
+			}else{
+				flatData = flatData +dataCell
+			}
+
+		}
+		//we dont need to add separator at the end
+		if len(data)-1 != key{
+			flatData  = flatData + ">"
+		}
+
+	}
+	return flatData
+}
+
+func uploadData(file []byte) []string{
+	fmt.Println("reading file")
+
+	// Create a temporary file within our temp-images directory that follows
+	// a particular naming pattern
+
+	reader := csv.NewReader(bytes.NewBuffer(file))
+	rownum := 0
+	var dataset []string
+	for {
 
 		rows, err := reader.Read()
 		if err != nil {
@@ -1149,19 +1922,43 @@ func uploadDataFlex2(reswt http.ResponseWriter, req *http.Request){
 	DataTableWithoutLabel := append(dataTable[:classIndex], dataTable[classIndex+1:]...)
 	// function post the http post request with data to required API
 
-	IdResponseM := getModelID(contract, "Vaidotas")
-	IdResponseD := getDataID(contract, "Vaidotas")
-	modelId := binary.BigEndian.Uint64(IdResponseM)
-	dataId := binary.BigEndian.Uint64(IdResponseD)
-	dataName := "dataCol"+ strconv.FormatUint(dataId, 10)
-
 	stringData := dataMatrixToString(DataTableWithoutLabel)
 	stringClass := strings.Join(dataTable[classIndex], ",")
 
 
-	initDataFlex(contract,dataName,"Vaidotas",dataId, stringData, stringClass)
-	if modelId > 0{
-		validateNewData(contract, dataName)
+	columns := len(DataTableWithoutLabel)
+	schemaName := req.FormValue("schema")
+	taskName := req.FormValue("task")
+	// name of the class column, a task with a target label only takes data labelled with it
+	classLabel := req.FormValue("classLabel")
+
+	// validation needs models of any owner in the task, not only models of this wallet
+	modelExists, err := hasRecords(contract, "GetAllModels", "", "", "", "", taskName)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+
+	var dataName string
+	if req.FormValue("visibility") == "private" {
+		dataName, err = initPrivateDataFlex(contract,requestedOwner, stringData, stringClass, columns, schemaName, taskName, classLabel)
+	}else{
+		dataName, err = initDataFlex(contract,requestedOwner, stringData, stringClass, columns, schemaName, taskName, classLabel)
+	}
+	// data rejected by schema validation, error says which row and column is wrong
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	if modelExists {
+		err = validateNewData(contract, dataName)
+		if redirectValidationSkipped(reswt, req, dataName, "/home", err) {
+			return
+		}
+		if err != nil {
+			writeTransactionError(reswt, err)
+			return
+		}
 	}
 	fmt.Println( "Successfully Uploaded File")
 	http.Redirect(reswt,req,"/home",302)
@@ -1319,65 +2116,158 @@ func uploadDataFlex2(reswt http.ResponseWriter, req *http.Request){
 	http.Redirect(reswt,req,"/home",302)
 }*/
 
-func initModel(contract *gateway.Contract , modelName string,  modelType string, libraryType string,owner string, ID uint64, modelB64 string){
+// initNativeModel returns the name the chaincode allocated for the model
+func initNativeModel(contract *gateway.Contract, modelType string, owner string, definition string, schemaName string, taskName string) (string, error){
+	result, err := contract.SubmitTransaction("initNativeModel", modelType, owner, definition, schemaName, taskName)
+	if err != nil {
+		return "", err
+	}
+	log.Println(string(result))
+	return string(result), nil
+}
+
+// publishModelVersion returns the name the chaincode allocated for the new version
+func publishModelVersion(contract *gateway.Contract, baseName string, owner string, parentVersion string, changelog string, fileHash string, size int, mediaType string) (string, error){
+	result, err := contract.SubmitTransaction("publishModelVersion", baseName, owner, parentVersion, changelog, fileHash, strconv.Itoa(size), mediaType)
+	if err != nil {
+		return "", err
+	}
+	log.Println(string(result))
+	return string(result), nil
+}
 
-	stringID := strconv.FormatUint(ID, 10)
-	result, err := contract.SubmitTransaction("initModelFile", modelName, modelType,libraryType,owner, stringID, modelB64)
+func publishNativeModelVersion(contract *gateway.Contract, baseName string, owner string, parentVersion string, changelog string, definition string) (string, error){
+	result, err := contract.SubmitTransaction("publishNativeModelVersion", baseName, owner, parentVersion, changelog, definition)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return "", err
+	}
+	log.Println(string(result))
+	return string(result), nil
+}
+
+// getModelVersion reads one version of the model from all its versions
+func getModelVersion(contract *gateway.Contract, baseName string, stringVersion string) (ModelFile, error){
+	var wrappedModels []ModelWrapper
+	version, err := strconv.ParseUint(stringVersion, 10, 64)
+	if err != nil {
+		return ModelFile{}, err
+	}
+	result, err := contract.EvaluateTransaction("GetModelVersions", baseName)
+	if err != nil {
+		return ModelFile{}, err
+	}
+	err = json.Unmarshal(result, &wrappedModels)
+	if err != nil {
+		return ModelFile{}, err
+	}
+	for _, wrappedModel := range wrappedModels {
+		if wrappedModel.Record.Version == version {
+			return wrappedModel.Record, nil
+		}
+	}
+	return ModelFile{}, fmt.Errorf("model %s has no version %d", baseName, version)
+}
+
+// getDefaultModelVersion reads the version of the model its lineage marks as default
+func getDefaultModelVersion(contract *gateway.Contract, baseName string) (ModelFile, error){
+	lineages, err := getModelLineageArray(contract)
+	if err != nil {
+		return ModelFile{}, err
+	}
+	for _, lineage := range lineages {
+		if lineage.Record.BaseName == baseName {
+			return getModelVersion(contract, baseName, strconv.FormatUint(lineage.Record.DefaultVersion, 10))
+		}
+	}
+	return ModelFile{}, fmt.Errorf("model %s has no versions", baseName)
+}
+
+func getModelLineageArray(contract *gateway.Contract) ([]ModelLineageWrapper, error){
+	var wrappedLineages []ModelLineageWrapper
+	result, err := contract.EvaluateTransaction("GetAllModelLineages")
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(result, &wrappedLineages)
+	return wrappedLineages, err
+}
+
+// setDefaultVersion marks which version of a model is used by default
+func setDefaultVersion(reswt http.ResponseWriter, req *http.Request){
+	_, err := contract.SubmitTransaction("setDefaultModelVersion", req.PostFormValue("baseName"), requestedOwner, req.PostFormValue("version"))
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	http.Redirect(reswt,req,"/showResults",302)
+}
+
+// initModel records the blob store hash of the model file and returns the name the chaincode allocated for the model
+func initModel(contract *gateway.Contract , modelType string, libraryType string,owner string, fileHash string, size int, mediaType string, schemaName string, taskName string) (string, error){
+
+	result, err := contract.SubmitTransaction("initModelFile", modelType,libraryType,owner, fileHash, strconv.Itoa(size), mediaType, schemaName, taskName)
+	if err != nil {
+		return "", err
 	}
 	log.Println(string(result))
+	return string(result), nil
 }
 
-func validateNewModel(contract *gateway.Contract , modelName string){
+func validateNewModel(contract *gateway.Contract , modelName string) error{
 	result, err := contract.SubmitTransaction("insertedModelFile", modelName)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return err
 	}
 	log.Println(string(result))
+	return nil
 }
 
-func validateNewData(contract *gateway.Contract , dataName string){
-	result, err := contract.SubmitTransaction("insertedDataFile", dataName )
+func validateNewData(contract *gateway.Contract , dataName string) error{
+	result, err := contract.SubmitTransaction("insertedDataFile", dataName)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return err
 	}
 	log.Println(string(result))
+	return nil
 }
 
-func testModel(contract *gateway.Contract, modelB64 string,  modelType string , libraryType string) []byte{
-	result, err := contract.SubmitTransaction("testModelFile", modelB64, modelType, libraryType)
+// testModel passes only the blob hash of the model, the oracle fetches the file from /blobs/<sha256>
+func testModel(contract *gateway.Contract, fileHash string, size int, mediaType string, modelType string , libraryType string) ([]byte, error){
+	result, err := contract.SubmitTransaction("testModelFile", fileHash, strconv.Itoa(size), mediaType, modelType, libraryType)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return nil, err
 	}
 	log.Println(string(result))
-	return result
+	return result, nil
 }
 
-func initData(contract *gateway.Contract, x string, y string, class string, username string, dataID string){
+func initData(contract *gateway.Contract, x string, y string, class string, username string, dataID string) error{
 	result, err := contract.SubmitTransaction("initTestData", x, y, class, username, dataID)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return err
 	}
 	log.Println(string(result))
+	return nil
 }
 
-func initValidate(contract *gateway.Contract,Model string, dataColID string){
+func initValidate(contract *gateway.Contract,Model string, dataColID string) error{
 	result, err := contract.SubmitTransaction("validateModelFileAPI", Model, dataColID)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return err
 	}
 
 	log.Println(string(result))
+	return nil
 }
 
-func initDataCol(contract *gateway.Contract,dataColName string,user string, ID uint64, x string, y string, label string){
-	stringID := strconv.FormatUint(ID, 10)
-	result, err := contract.SubmitTransaction("initDataFile",dataColName,user,stringID,x,y,label)
+// initDataCol returns the name the chaincode allocated for the data
+func initDataCol(contract *gateway.Contract,user string, x string, y string, label string) (string, error){
+	result, err := contract.SubmitTransaction("initDataFile",user,x,y,label)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return "", err
 	}
 	log.Println(string(result))
+	return string(result), nil
 }
 
 /*
@@ -1389,16 +2279,930 @@ func initDataCol(contract *gateway.Contract,dataColName string,user string, ID u
 */
 
 
-func initDataFlex(contract *gateway.Contract,batchName string,owner string, ID uint64, stringData string, stringClass string){
-	stringID := strconv.FormatUint(ID, 10)
-	result, err := contract.SubmitTransaction("initFlexData",batchName,owner,stringID,stringData,stringClass)
+// initDataFlex returns the name the chaincode allocated for the data
+func initDataFlex(contract *gateway.Contract,owner string, stringData string, stringClass string, columns int, schemaName string, taskName string, classLabel string) (string, error){
+	result, err := contract.SubmitTransaction("initFlexData",owner,stringData,stringClass,strconv.Itoa(columns),schemaName,taskName,classLabel)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		return "", err
+	}
+	log.Println(string(result))
+	return string(result), nil
+}
+
+// initPrivateDataFlex passes data in the transient map so it is only kept in the private data collection
+func initPrivateDataFlex(contract *gateway.Contract,owner string, stringData string, stringClass string, columns int, schemaName string, taskName string, classLabel string) (string, error){
+	transientData := map[string][]byte{
+		"DataTable": []byte(stringData),
+		"Class": []byte(stringClass),
+	}
+	txn, err := contract.CreateTransaction("initPrivateFlexData", gateway.WithTransient(transientData))
+	if err != nil {
+		return "", err
+	}
+	result, err := txn.Submit(owner, strconv.Itoa(columns), schemaName, taskName, classLabel)
+	if err != nil {
+		return "", err
+	}
+	log.Println(string(result))
+	return string(result), nil
+}
+
+
+
+//PMML evaluator ------------------------------------------------------------------------------------------------
+
+// PMML documents with a RegressionModel or TreeModel classifying into labels 0 and 1 are evaluated in Go,
+// active mining fields are matched to data columns by the feature names of the model schema
+type PMMLDocument struct{
+	XMLName xml.Name `xml:"PMML"`
+	RegressionModel *PMMLRegressionModel `xml:"RegressionModel"`
+	TreeModel *PMMLTreeModel `xml:"TreeModel"`
+}
+
+type PMMLMiningSchema struct{
+	Fields []PMMLMiningField `xml:"MiningField"`
+}
+
+type PMMLMiningField struct{
+	Name string `xml:"name,attr"`
+	UsageType string `xml:"usageType,attr"`
+}
+
+type PMMLRegressionModel struct{
+	FunctionName string `xml:"functionName,attr"`
+	NormalizationMethod string `xml:"normalizationMethod,attr"`
+	MiningSchema PMMLMiningSchema `xml:"MiningSchema"`
+	Tables []PMMLRegressionTable `xml:"RegressionTable"`
+}
+
+type PMMLRegressionTable struct{
+	Intercept float64 `xml:"intercept,attr"`
+	TargetCategory string `xml:"targetCategory,attr"`
+	Predictors []PMMLNumericPredictor `xml:"NumericPredictor"`
+}
+
+type PMMLNumericPredictor struct{
+	Name string `xml:"name,attr"`
+	Exponent int `xml:"exponent,attr"`
+	Coefficient float64 `xml:"coefficient,attr"`
+}
+
+type PMMLTreeModel struct{
+	FunctionName string `xml:"functionName,attr"`
+	MiningSchema PMMLMiningSchema `xml:"MiningSchema"`
+	Node PMMLNode `xml:"Node"`
+}
+
+type PMMLNode struct{
+	Score string `xml:"score,attr"`
+	PMMLPredicate
+	ScoreDistributions []PMMLScoreDistribution `xml:"ScoreDistribution"`
+	Nodes []PMMLNode `xml:"Node"`
+}
+
+// PMMLPredicate holds the one predicate of a node, or the operands of a compound predicate
+type PMMLPredicate struct{
+	True *struct{} `xml:"True"`
+	False *struct{} `xml:"False"`
+	SimplePredicates []PMMLSimplePredicate `xml:"SimplePredicate"`
+	CompoundPredicates []PMMLCompoundPredicate `xml:"CompoundPredicate"`
+}
+
+type PMMLSimplePredicate struct{
+	Field string `xml:"field,attr"`
+	Operator string `xml:"operator,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type PMMLCompoundPredicate struct{
+	BooleanOperator string `xml:"booleanOperator,attr"`
+	PMMLPredicate
+}
+
+type PMMLScoreDistribution struct{
+	Value string `xml:"value,attr"`
+	RecordCount float64 `xml:"recordCount,attr"`
+	Probability string `xml:"probability,attr"`
+}
+
+func parsePMML(fileBytes []byte) (*PMMLDocument, error) {
+	var document PMMLDocument
+	err := xml.Unmarshal(fileBytes, &document)
+	if err != nil {
+		return nil, err
+	}
+	if (document.RegressionModel == nil) == (document.TreeModel == nil) {
+		return nil, fmt.Errorf("PMML must hold one RegressionModel or TreeModel")
+	}
+	if document.RegressionModel != nil && len(document.RegressionModel.Tables) == 0 {
+		return nil, fmt.Errorf("PMML RegressionModel has no RegressionTable")
+	}
+	return &document, nil
+}
+
+// activeFields are the inputs of the model in mining schema order
+func (document *PMMLDocument) activeFields() []string {
+	miningSchema := document.TreeModel.miningSchema()
+	if document.RegressionModel != nil {
+		miningSchema = document.RegressionModel.MiningSchema
+	}
+	var fields []string
+	for _, field := range miningSchema.Fields {
+		if field.UsageType == "" || field.UsageType == "active" {
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
+}
+
+func (model *PMMLTreeModel) miningSchema() PMMLMiningSchema {
+	if model == nil {
+		return PMMLMiningSchema{}
+	}
+	return model.MiningSchema
+}
+
+// Predict returns probability of label 1 for the row of field values
+func (document *PMMLDocument) Predict(row map[string]float64) (float64, error) {
+	if document.RegressionModel != nil {
+		return document.RegressionModel.predict(row)
+	}
+	return document.TreeModel.predict(row)
+}
+
+func isPositiveLabel(label string) bool {
+	n, err := strconv.ParseFloat(strings.TrimSpace(label), 64)
+	return err == nil && n == 1
+}
+
+func (model *PMMLRegressionModel) predict(row map[string]float64) (float64, error) {
+	values := make([]float64, len(model.Tables))
+	for i, table := range model.Tables {
+		values[i] = table.Intercept
+		for _, predictor := range table.Predictors {
+			x, ok := row[predictor.Name]
+			if !ok {
+				return 0, fmt.Errorf("PMML predictor %s is not in the data", predictor.Name)
+			}
+			exponent := predictor.Exponent
+			if exponent == 0 {
+				exponent = 1
+			}
+			values[i] += predictor.Coefficient * math.Pow(x, float64(exponent))
+		}
+	}
+	if model.FunctionName == "regression" {
+		if model.NormalizationMethod == "logit" {
+			return 1 / (1 + math.Exp(-values[0])), nil
+		}
+		return values[0], nil
+	}
+
+	probabilities := make([]float64, len(values))
+	switch model.NormalizationMethod {
+	case "softmax":
+		sum := 0.0
+		for i, value := range values {
+			probabilities[i] = math.Exp(value)
+			sum += probabilities[i]
+		}
+		for i := range probabilities {
+			probabilities[i] /= sum
+		}
+	case "logit":
+		// last category takes the probability left by the others
+		rest := 1.0
+		for i := 0; i < len(values)-1; i++ {
+			probabilities[i] = 1 / (1 + math.Exp(-values[i]))
+			rest -= probabilities[i]
+		}
+		probabilities[len(values)-1] = rest
+	case "", "none":
+		copy(probabilities, values)
+	default:
+		return 0, fmt.Errorf("PMML normalization method is not supported: %s", model.NormalizationMethod)
+	}
+	for i, table := range model.Tables {
+		if isPositiveLabel(table.TargetCategory) {
+			return probabilities[i], nil
+		}
+	}
+	return 0, fmt.Errorf("PMML RegressionModel has no table for label 1")
+}
+
+// tree is walked down through the first child whose predicate holds, the last node reached gives the prediction
+func (model *PMMLTreeModel) predict(row map[string]float64) (float64, error) {
+	node := &model.Node
+	for {
+		var next *PMMLNode
+		for i := range node.Nodes {
+			holds, err := node.Nodes[i].holds(row)
+			if err != nil {
+				return 0, err
+			}
+			if holds {
+				next = &node.Nodes[i]
+				break
+			}
+		}
+		if next == nil {
+			return node.probability()
+		}
+		node = next
+	}
+}
+
+func (node *PMMLNode) probability() (float64, error) {
+	if len(node.ScoreDistributions) == 0 {
+		if isPositiveLabel(node.Score) {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	total := 0.0
+	for _, distribution := range node.ScoreDistributions {
+		total += distribution.RecordCount
+	}
+	for _, distribution := range node.ScoreDistributions {
+		if !isPositiveLabel(distribution.Value) {
+			continue
+		}
+		if distribution.Probability != "" {
+			return strconv.ParseFloat(distribution.Probability, 64)
+		}
+		if total == 0 {
+			return 0, fmt.Errorf("PMML ScoreDistribution has no records")
+		}
+		return distribution.RecordCount / total, nil
+	}
+	return 0, nil
+}
+
+// holds evaluates the single predicate of a node
+func (predicate *PMMLPredicate) holds(row map[string]float64) (bool, error) {
+	results, err := predicate.operands(row)
+	if err != nil {
+		return false, err
+	}
+	if len(results) != 1 {
+		return false, fmt.Errorf("PMML node must have exactly one predicate")
+	}
+	return results[0], nil
+}
+
+func (predicate *PMMLPredicate) operands(row map[string]float64) ([]bool, error) {
+	var results []bool
+	if predicate.True != nil {
+		results = append(results, true)
+	}
+	if predicate.False != nil {
+		results = append(results, false)
+	}
+	for _, simple := range predicate.SimplePredicates {
+		result, err := simple.holds(row)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	for _, compound := range predicate.CompoundPredicates {
+		result, err := compound.holds(row)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (predicate *PMMLSimplePredicate) holds(row map[string]float64) (bool, error) {
+	x, ok := row[predicate.Field]
+	switch predicate.Operator {
+	case "isMissing":
+		return !ok, nil
+	case "isNotMissing":
+		return ok, nil
+	}
+	if !ok {
+		return false, fmt.Errorf("PMML field %s is not in the data", predicate.Field)
+	}
+	value, err := strconv.ParseFloat(predicate.Value, 64)
+	if err != nil {
+		return false, fmt.Errorf("PMML predicate on %s compares with non numeric value %s", predicate.Field, predicate.Value)
+	}
+	switch predicate.Operator {
+	case "equal":
+		return x == value, nil
+	case "notEqual":
+		return x != value, nil
+	case "lessThan":
+		return x < value, nil
+	case "lessOrEqual":
+		return x <= value, nil
+	case "greaterThan":
+		return x > value, nil
+	case "greaterOrEqual":
+		return x >= value, nil
+	}
+	return false, fmt.Errorf("PMML operator is not supported: %s", predicate.Operator)
+}
+
+func (predicate *PMMLCompoundPredicate) holds(row map[string]float64) (bool, error) {
+	results, err := predicate.operands(row)
+	if err != nil {
+		return false, err
+	}
+	switch predicate.BooleanOperator {
+	case "and":
+		for _, result := range results {
+			if !result {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "or":
+		for _, result := range results {
+			if result {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "xor":
+		holds := false
+		for _, result := range results {
+			holds = holds != result
+		}
+		return holds, nil
+	}
+	return false, fmt.Errorf("PMML boolean operator is not supported: %s", predicate.BooleanOperator)
+}
+
+// pmmlColumns maps active fields of the model to data columns through the feature schema
+func pmmlColumns(document *PMMLDocument, schema FeatureSchema) (map[string]int, error) {
+	schemaColumns := make(map[string]int)
+	for column, feature := range schema.Features {
+		schemaColumns[feature.Name] = column
+	}
+	columns := make(map[string]int)
+	for _, field := range document.activeFields() {
+		column, ok := schemaColumns[field]
+		if !ok {
+			return nil, fmt.Errorf("PMML field %s is not a feature of schema %s", field, schema.Name)
+		}
+		columns[field] = column
+	}
+	return columns, nil
+}
+
+// evaluatePMML scores every row of the data with the PMML model
+func evaluatePMML(fileBytes []byte, data DataFlex, schema FeatureSchema) ([]float64, error) {
+	document, err := parsePMML(fileBytes)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := pmmlColumns(document, schema)
+	if err != nil {
+		return nil, err
+	}
+	predictions := make([]float64, 0, len(data.Class))
+	for r := 0; r < len(data.Class); r++ {
+		row := make(map[string]float64, len(columns))
+		for field, column := range columns {
+			if column >= len(data.Data) || r >= len(data.Data[column]) {
+				return nil, fmt.Errorf("data %s has no value of %s in row %d", data.DataName, field, r)
+			}
+			row[field], err = strconv.ParseFloat(strings.TrimSpace(data.Data[column][r]), 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		prediction, err := document.Predict(row)
+		if err != nil {
+			return nil, err
+		}
+		predictions = append(predictions, prediction)
+	}
+	return predictions, nil
+}
+
+// testPMML checks the model can be evaluated and its inputs are features of the schema
+func testPMML(contract *gateway.Contract, fileBytes []byte, schemaName string) error {
+	document, err := parsePMML(fileBytes)
+	if err != nil {
+		return err
+	}
+	schema, err := getFeatureSchema(contract, schemaName)
+	if err != nil {
+		return err
+	}
+	_, err = pmmlColumns(document, schema)
+	return err
+}
+
+func getFeatureSchema(contract *gateway.Contract, schemaName string) (FeatureSchema, error) {
+	var schema FeatureSchema
+	schemaBytes, err := contract.EvaluateTransaction("GetFeatureSchema", schemaName)
+	if err != nil {
+		return schema, err
+	}
+	err = json.Unmarshal(schemaBytes, &schema)
+	return schema, err
+}
+
+//Reward tokens -------------------------------------------------------------------------------------------------
+
+func getTokenAccountArray(contract *gateway.Contract) ([]TokenAccountWrapper, error){
+	var wrappedAccounts[] TokenAccountWrapper
+	result, err := contract.EvaluateTransaction("GetAllTokenAccounts")
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(result, &wrappedAccounts)
+	return wrappedAccounts, err
+}
+
+func getRewardRoundArray(contract *gateway.Contract) ([]RewardRoundWrapper, error){
+	var wrappedRounds[] RewardRoundWrapper
+	result, err := contract.EvaluateTransaction("GetAllRewardRounds")
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(result, &wrappedRounds)
+	return wrappedRounds, err
+}
+
+// walletPage shows the balance of the wallet identity, all balances and distributed reward rounds
+func walletPage(reswt http.ResponseWriter, req *http.Request){
+	var page WalletPage
+	result, err := contract.EvaluateTransaction("GetTokenBalance", requestedOwner)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	err = json.Unmarshal(result, &page.Account)
+	if err != nil {
+		log.Printf("Failed to marshall json: %v", err)
+	}
+	page.Accounts, err = getTokenAccountArray(contract)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	page.Rounds, err = getRewardRoundArray(contract)
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	tmplWallet.ExecuteTemplate(reswt, "Wallet.html", page)
+}
+
+func transferTokens(reswt http.ResponseWriter, req *http.Request){
+	_, err := contract.SubmitTransaction("transferTokens", req.PostFormValue("recipient"), req.PostFormValue("amount"))
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	http.Redirect(reswt,req,"/wallet",302)
+}
+
+// only admin identities may mint, others get the 403 page
+func mintTokens(reswt http.ResponseWriter, req *http.Request){
+	_, err := contract.SubmitTransaction("mintTokens", req.PostFormValue("recipient"), req.PostFormValue("amount"))
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	http.Redirect(reswt,req,"/wallet",302)
+}
+
+// distributeRewards pays the pool from the wallet identity by the Shapley values the results page sent with the form
+func distributeRewards(reswt http.ResponseWriter, req *http.Request){
+	_, err := contract.SubmitTransaction("distributeRewards", req.PostFormValue("round"), req.PostFormValue("pool"), req.PostFormValue("shares"), req.PostFormValue("task"))
+	if err != nil {
+		writeTransactionError(reswt, err)
+		return
+	}
+	http.Redirect(reswt,req,"/wallet",302)
+}
+
+//Chaincode lifecycle events ------------------------------------------------------------------------------------
+
+// chaincode sends all events of a transaction as one JSON array named after the first of them
+const lifecycleEventFilter = "ModelRegistered|DatasetRegistered|ResultsRecorded|ValidationFailed"
+
+// number of events kept for the results page
+const recentEventLimit = 50
+
+type LifecycleEvent struct{
+	Type string `json:"Type"`
+	TxID string `json:"TxID"`
+	Model string `json:"Model,omitempty"`
+	Data string `json:"Data,omitempty"`
+	Owner string `json:"Owner,omitempty"`
+	Reason string `json:"Reason,omitempty"`
+	BlockNumber uint64 `json:"BlockNumber"`
+}
+
+// EventFeed keeps recent committed events and forwards new ones to connected browsers
+type EventFeed struct{
+	mutex sync.Mutex
+	recent []LifecycleEvent
+	subscribers map[chan LifecycleEvent]bool
+}
+
+var lifecycleEvents = &EventFeed{subscribers: make(map[chan LifecycleEvent]bool)}
+
+func (feed *EventFeed) Publish(event LifecycleEvent) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	feed.recent = append(feed.recent, event)
+	if len(feed.recent) > recentEventLimit {
+		feed.recent = feed.recent[len(feed.recent)-recentEventLimit:]
+	}
+	for subscriber := range feed.subscribers {
+		// slow browsers miss events instead of blocking the listener
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// Recent returns kept events from the newest
+func (feed *EventFeed) Recent() []LifecycleEvent {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	recent := make([]LifecycleEvent, len(feed.recent))
+	for i, event := range feed.recent {
+		recent[len(recent)-1-i] = event
+	}
+	return recent
+}
+
+func (feed *EventFeed) Subscribe() chan LifecycleEvent {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	subscriber := make(chan LifecycleEvent, recentEventLimit)
+	feed.subscribers[subscriber] = true
+	return subscriber
+}
+
+func (feed *EventFeed) Unsubscribe(subscriber chan LifecycleEvent) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	delete(feed.subscribers, subscriber)
+}
+
+func listenLifecycleEvents(contract *gateway.Contract) {
+	registration, notifier, err := contract.RegisterEvent(lifecycleEventFilter)
+	if err != nil {
+		log.Printf("Failed to register for chaincode events: %v", err)
+		return
+	}
+	defer contract.Unregister(registration)
+
+	for ccEvent := range notifier {
+		var events []LifecycleEvent
+		err := json.Unmarshal(ccEvent.Payload, &events)
+		if err != nil {
+			log.Printf("Failed to read event %s of transaction %s: %v", ccEvent.EventName, ccEvent.TxID, err)
+			continue
+		}
+		for _, event := range events {
+			event.BlockNumber = ccEvent.BlockNumber
+			lifecycleEvents.Publish(event)
+		}
+	}
+}
+
+// streamEvents sends committed lifecycle events to the browser as server-sent events
+func streamEvents(reswt http.ResponseWriter, req *http.Request) {
+	flusher, ok := reswt.(http.Flusher)
+	if !ok {
+		http.Error(reswt, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	reswt.Header().Set("Content-Type", "text/event-stream")
+	reswt.Header().Set("Cache-Control", "no-cache")
+	reswt.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	subscriber := lifecycleEvents.Subscribe()
+	defer lifecycleEvents.Unsubscribe(subscriber)
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case event := <-subscriber:
+			eventAsBytes, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Failed to marshall json: %v", err)
+				continue
+			}
+			fmt.Fprintf(reswt, "event: %s\ndata: %s\n\n", event.Type, eventAsBytes)
+			flusher.Flush()
+		}
+	}
+}
+
+//Content-addressed blob store -----------------------------------------------------------------------------------
+
+const blobStoreDir = "/home/vdledger/HLtwothree/fabric-samples/asset-transfer-basic/application-go/Files/"
+
+func blobPath(hash string) (string, error) {
+	hashBytes, err := hex.DecodeString(hash)
+	if err != nil || len(hashBytes) != sha256.Size {
+		return "", fmt.Errorf("not a SHA-256 hex digest: %s", hash)
+	}
+	return filepath.Join(blobStoreDir, strings.ToLower(hash)), nil
+}
+
+// putBlob stores file bytes under their SHA-256 hash, storing the same content again is a no-op
+func putBlob(fileBytes []byte) (string, error) {
+	hash := sha256Hex(fileBytes)
+	path, err := blobPath(hash)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	// written to a temporary file first so readers never see a partial blob
+	tempFile, err := ioutil.TempFile(blobStoreDir, "blob-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = tempFile.Write(fileBytes)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return "", err
+	}
+	err = os.Rename(tempFile.Name(), path)
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return "", err
+	}
+	return hash, nil
+}
+
+// getBlob reads file bytes by hash and checks they were not altered
+func getBlob(hash string) ([]byte, error) {
+	path, err := blobPath(hash)
+	if err != nil {
+		return nil, err
+	}
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if sha256Hex(fileBytes) != strings.ToLower(hash) {
+		return nil, fmt.Errorf("blob %s does not match its hash", hash)
+	}
+	return fileBytes, nil
+}
+
+// serveBlob lets oracles fetch model files by hash from /blobs/<sha256>
+func serveBlob(reswt http.ResponseWriter, req *http.Request) {
+	hash := strings.TrimPrefix(req.URL.Path, "/blobs/")
+	fileBytes, err := getBlob(hash)
+	if err != nil {
+		http.NotFound(reswt, req)
+		return
+	}
+	reswt.Header().Set("Content-Type", "application/octet-stream")
+	reswt.Write(fileBytes)
+}
+
+//Off-chain oracle worker ---------------------------------------------------------------------------------------
+
+// runOracleWorker polls validation requests, calls oracles off-chain and submits their committed results
+func runOracleWorker(contract *gateway.Contract, interval time.Duration) {
+	log.Println("============ oracle worker starts ============")
+	for {
+		processPendingValidations(contract)
+		time.Sleep(interval)
+	}
+}
+
+func processPendingValidations(contract *gateway.Contract) {
+	var wrappedRequests []ValidationRequestWrapper
+	result, err := contract.EvaluateTransaction("GetPendingValidations")
+	if err != nil {
+		log.Printf("Failed to evaluate transaction: %v", err)
+		return
+	}
+	err = json.Unmarshal(result, &wrappedRequests)
+	if err != nil {
+		log.Printf("Failed to marshall json: %v", err)
+		return
+	}
+
+	for _, request := range wrappedRequests {
+		err = processValidation(contract, request)
+		if err != nil {
+			log.Printf("Failed to validate %s on %s: %v", request.Record.ModelName, request.Record.DataColName, err)
+		}
+	}
+}
+
+// modelFileBytes returns the model file from the blob store or decodes the one stored inline
+func modelFileBytes(model ModelFile) ([]byte, error) {
+	if model.File == "" && model.Hash != "" {
+		return getBlob(model.Hash)
+	}
+	return b64.URLEncoding.DecodeString(model.File)
+}
+
+// validateWithOracle posts the payload to the endpoint the chaincode built for the model library
+// and returns the response with the signature the oracle sends in the X-Oracle-Signature header
+func validateWithOracle(payload FilePayload, oracleUrl string) ([]byte, string, error) {
+	// models in the blob store are fetched by hash and sent to the oracle inline
+	if payload.Model.File == "" && payload.Model.Hash != "" {
+		fileBytes, err := getBlob(payload.Model.Hash)
+		if err != nil {
+			return nil, "", err
+		}
+		payload.Model.File = b64.URLEncoding.EncodeToString(fileBytes)
+	}
+
+	if oracleUrl == "" {
+		return nil, "", fmt.Errorf("no enabled oracle for library type %s", payload.Model.LibraryType)
+	}
+	payloadJson, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.Post(oracleUrl, "application/json", bytes.NewBuffer(payloadJson))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	signature := resp.Header.Get("X-Oracle-Signature")
+	if signature == "" {
+		return nil, "", fmt.Errorf("oracle %s did not sign its response", oracleUrl)
+	}
+	response, err := ioutil.ReadAll(resp.Body)
+	return response, signature, err
+}
+
+// validatePMML answers like a portable oracle, with predictions as {"Results": [...]}
+func validatePMML(contract *gateway.Contract, payload FilePayload) ([]byte, error) {
+	fileBytes, err := modelFileBytes(payload.Model)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := getFeatureSchema(contract, payload.Model.SchemaName)
+	if err != nil {
+		return nil, err
+	}
+	predictions, err := evaluatePMML(fileBytes, payload.Data, schema)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct{
+		Results []float64 `json:"Results"`
+	}{predictions})
+}
+
+// processValidation calls the oracle with the stored model and data and submits the response with the oracle signature
+// over it and their hashes, the chaincode verifies it against the registered oracle key and decodes it
+func processValidation(contract *gateway.Contract, wrappedRequest ValidationRequestWrapper) error {
+	var payload FilePayload
+	request := wrappedRequest.Record
+	modelBytes, err := contract.EvaluateTransaction("readModel", request.ModelName)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(modelBytes, &payload.Model)
+	if err != nil {
+		return err
+	}
+	dataBytes, err := contract.EvaluateTransaction("ReadData", request.DataColName)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(dataBytes, &payload.Data)
+	if err != nil {
+		return err
+	}
+	// private data of another organisation is only readable by the workers of that organisation
+	if payload.Data.Private && payload.Data.Data == nil {
+		return nil
+	}
+
+	modelHash := modelFileHash(payload.Model)
+	dataHash, err := dataFlexHash(payload.Data)
+	if err != nil {
+		return err
+	}
+
+	// PMML models are evaluated by the worker itself, native models by the chaincode on a peer of the worker
+	// organisation, which holds its private data, and other models by the oracle of their library
+	var response []byte
+	var signature string
+	switch payload.Model.LibraryType {
+	case "PMML":
+		response, err = validatePMML(contract, payload)
+	case "GO":
+		response, err = contract.EvaluateTransaction("EvaluateNativeModel", request.ModelName, request.DataColName)
+	default:
+		response, signature, err = validateWithOracle(payload, wrappedRequest.OracleUrl)
+	}
+	if err != nil {
+		return err
+	}
+	// oracles sign their own responses, the worker signs those it got without an oracle
+	if signature == "" {
+		signature, err = signValidation(validationMessage(modelHash, dataHash, string(response)))
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := contract.SubmitTransaction("submitValidationResult", request.ModelName, request.DataColName, modelHash, dataHash, string(response), signature)
+	if err != nil {
+		return err
 	}
 	log.Println(string(result))
+	return nil
 }
 
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashes are calculated the same way as in the chaincode, blob store models are hashed over raw file bytes
+func modelFileHash(model ModelFile) string {
+	if model.Hash != "" {
+		return model.Hash
+	}
+	return sha256Hex([]byte(model.File))
+}
 
+func dataFlexHash(data DataFlex) (string, error) {
+	if data.Hash != "" {
+		return data.Hash, nil
+	}
+	contentBytes, err := json.Marshal(struct{
+		Data [][]string `json:"DataTable"`
+		Class []string `json:"Class"`
+	}{data.Data, data.Class})
+	if err != nil {
+		return "", err
+	}
+	return sha256Hex(contentBytes), nil
+}
+
+// oracles sign their response together with hashes of the model and data it was calculated for
+func validationMessage(modelHash string, dataHash string, response string) []byte {
+	return []byte(modelHash + ":" + dataHash + ":" + response)
+}
+
+// signValidation signs the message with the worker oracle key as base64 encoded ASN.1 ECDSA signature of its SHA-256 digest
+func signValidation(message []byte) (string, error) {
+	if oracleSigningKey == "" {
+		return "", fmt.Errorf("ORACLE_SIGNING_KEY is not set, PMML and native results can not be signed")
+	}
+	keyPEM, err := ioutil.ReadFile(oracleSigningKey)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return "", fmt.Errorf("%s is not PEM encoded", oracleSigningKey)
+	}
+	var key *ecdsa.PrivateKey
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err == nil {
+		var ok bool
+		key, ok = parsedKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("%s is not an ECDSA key", oracleSigningKey)
+		}
+	}else{
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return "", err
+		}
+	}
+	digest := sha256.Sum256(message)
+	r, s, err := ecdsa.Sign(crand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signatureBytes, err := asn1.Marshal(struct{
+		R, S *big.Int
+	}{r, s})
+	if err != nil {
+		return "", err
+	}
+	return b64.StdEncoding.EncodeToString(signatureBytes), nil
+}
 
 func initContract() *gateway.Contract{
 
@@ -1446,6 +3250,8 @@ func initContract() *gateway.Contract{
 	}
 
 	contract := network.GetContract("smodel")
+	ledgerContract = network.GetContract("qscc")
+	ledgerChannel = network.Name()
 	return contract
 }
 
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tableGame values coalitions of up to 64 players from a table keyed by their bitmask
+func tableGame(values map[uint64]float64) coalitionValue {
+	return func(c Coalition) float64 {
+		return values[c[0]]
+	}
+}
+
+// additiveGame is worth the sum of the weights of its members, every player is worth exactly its weight
+func additiveGame(weights []float64) coalitionValue {
+	return func(c Coalition) float64 {
+		sum := 0.0
+		for _, player := range c.Members() {
+			sum += weights[player]
+		}
+		return sum
+	}
+}
+
+// three players A, B and C are bits 0, 1 and 2
+var threePlayerGame = map[uint64]float64{
+	0b000: 0, 0b001: 10, 0b010: 20, 0b100: 30,
+	0b011: 40, 0b101: 50, 0b110: 60, 0b111: 90,
+}
+
+// left glove A pairs with either right glove B or C
+var gloveGame = map[uint64]float64{
+	0b000: 0, 0b001: 0, 0b010: 0, 0b100: 0,
+	0b011: 1, 0b101: 1, 0b110: 0, 0b111: 1,
+}
+
+// every coalition is worth 5 more than in the three player game, Shapley values do not change
+var shiftedGame = map[uint64]float64{
+	0b000: 5, 0b001: 15, 0b010: 25, 0b100: 35,
+	0b011: 45, 0b101: 55, 0b110: 65, 0b111: 95,
+}
+
+func approxEqual(a []float64, b []float64, tolerance float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func TestExactShapley(t *testing.T) {
+	cases := []struct {
+		name    string
+		game    map[uint64]float64
+		shapley []float64
+	}{
+		// A: 10/3 + 20/6 + 20/6 + 30/3, B: 20/3 + 30/6 + 30/6 + 40/3, C: 30/3 + 40/6 + 40/6 + 50/3
+		{"three players", threePlayerGame, []float64{20, 30, 40}},
+		{"glove game", gloveGame, []float64{2.0 / 3, 1.0 / 6, 1.0 / 6}},
+		{"empty coalition has value", shiftedGame, []float64{20, 30, 40}},
+	}
+	for _, c := range cases {
+		shapley := exactShapley(3, tableGame(c.game))
+		if !approxEqual(shapley, c.shapley, 1e-9) {
+			t.Errorf("%s: Shapley values are %v, want %v", c.name, shapley, c.shapley)
+		}
+		// efficiency, values split exactly what the grand coalition adds to the empty one
+		if total, want := sum(shapley), c.game[0b111]-c.game[0b000]; math.Abs(total-want) > 1e-9 {
+			t.Errorf("%s: Shapley values sum to %v, want v(N)-v(∅) = %v", c.name, total, want)
+		}
+	}
+}
+
+func TestExactShapleyEfficiency(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 5, 8} {
+		values := make(map[uint64]float64)
+		for mask := uint64(0); mask < uint64(1)<<uint(n); mask++ {
+			values[mask] = rng.Float64()
+		}
+		shapley := exactShapley(n, tableGame(values))
+		grand := uint64(1)<<uint(n) - 1
+		if total, want := sum(shapley), values[grand]-values[0]; math.Abs(total-want) > 1e-9 {
+			t.Errorf("%d players: Shapley values sum to %v, want v(N)-v(∅) = %v", n, total, want)
+		}
+	}
+}
+
+func TestMonteCarloShapleyWithinStandardError(t *testing.T) {
+	cases := []struct {
+		name string
+		game map[uint64]float64
+	}{
+		{"three players", threePlayerGame},
+		{"glove game", gloveGame},
+		{"empty coalition has value", shiftedGame},
+	}
+	for _, c := range cases {
+		exact := exactShapley(3, tableGame(c.game))
+		// tolerance 0 never truncates a permutation so the estimate is unbiased
+		estimate, stdErr := monteCarloShapley(3, tableGame(c.game), 2000, 0, rand.New(rand.NewSource(7)))
+		for i := range exact {
+			if stdErr[i] <= 0 {
+				t.Errorf("%s: player %d has no standard error", c.name, i)
+			}
+			if math.Abs(estimate[i]-exact[i]) > 4*stdErr[i] {
+				t.Errorf("%s: player %d is estimated %v ± %v, exact value is %v", c.name, i, estimate[i], stdErr[i], exact[i])
+			}
+		}
+		// every permutation adds up to v(N)-v(∅), so does their average
+		if total, want := sum(estimate), c.game[0b111]-c.game[0b000]; math.Abs(total-want) > 1e-9 {
+			t.Errorf("%s: estimates sum to %v, want %v", c.name, total, want)
+		}
+	}
+}
+
+func TestMonteCarloShapleyAdditiveGame(t *testing.T) {
+	// marginal contribution of a player never depends on the permutation, estimates are exact
+	weights := []float64{0.5, -1, 2, 0, 3}
+	estimate, stdErr := monteCarloShapley(len(weights), additiveGame(weights), 50, 0, rand.New(rand.NewSource(3)))
+	if !approxEqual(estimate, weights, 1e-9) {
+		t.Errorf("estimates are %v, want %v", estimate, weights)
+	}
+	if !approxEqual(stdErr, make([]float64, len(weights)), 1e-9) {
+		t.Errorf("standard errors are %v, want zero", stdErr)
+	}
+}
+
+func TestCoalition(t *testing.T) {
+	cases := []struct {
+		name    string
+		players int
+		members []int
+	}{
+		{"empty", 10, []int{}},
+		{"one word", 64, []int{0, 5, 63}},
+		{"word boundary", 130, []int{0, 63, 64, 129}},
+	}
+	for _, c := range cases {
+		coalition := NewCoalition(c.players)
+		if len(coalition) != (c.players+63)/64 {
+			t.Errorf("%s: %d players take %d words", c.name, c.players, len(coalition))
+		}
+		for _, player := range c.members {
+			coalition.Add(player)
+		}
+		if coalition.Size() != len(c.members) {
+			t.Errorf("%s: size is %d, want %d", c.name, coalition.Size(), len(c.members))
+		}
+		if !reflect.DeepEqual(coalition.Members(), c.members) {
+			t.Errorf("%s: members are %v, want %v", c.name, coalition.Members(), c.members)
+		}
+		for player := 0; player < c.players; player++ {
+			want := false
+			for _, member := range c.members {
+				want = want || member == player
+			}
+			if coalition.Has(player) != want {
+				t.Errorf("%s: Has(%d) is %v", c.name, player, !want)
+			}
+		}
+
+		joined := coalition.With(c.players - 1)
+		if !joined.Has(c.players-1) || joined.Size() != len(c.members)+btoi(!coalition.Has(c.players-1)) {
+			t.Errorf("%s: With(%d) gives members %v", c.name, c.players-1, joined.Members())
+		}
+		if coalition.Size() != len(c.members) {
+			t.Errorf("%s: With changed the original coalition to %v", c.name, coalition.Members())
+		}
+		for _, player := range c.members {
+			coalition.Remove(player)
+		}
+		if coalition.Size() != 0 {
+			t.Errorf("%s: members %v are left after removing all", c.name, coalition.Members())
+		}
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestCoalitionCache(t *testing.T) {
+	for _, players := range []int{3, 64, 130} {
+		calls := make(map[string]int)
+		cache := NewCoalitionCache(func(c Coalition) float64 {
+			calls[fmt.Sprint(c.Members())]++
+			return float64(c.Size())
+		})
+		coalition := NewCoalition(players)
+		coalition.Add(0)
+		coalition.Add(players - 1)
+		for i := 0; i < 3; i++ {
+			if v := cache.Value(coalition); v != 2 {
+				t.Errorf("%d players: coalition value is %v, want 2", players, v)
+			}
+			// an equal coalition built separately hits the same entry
+			if v := cache.Value(NewCoalition(players).With(0).With(players - 1)); v != 2 {
+				t.Errorf("%d players: coalition value is %v, want 2", players, v)
+			}
+		}
+		cache.Value(NewCoalition(players))
+		if len(calls) != 2 {
+			t.Errorf("%d players: value was calculated for %d coalitions, want 2", players, len(calls))
+		}
+		for key, count := range calls {
+			if count != 1 {
+				t.Errorf("%d players: coalition %s was calculated %d times", players, key, count)
+			}
+		}
+	}
+}
+
+func TestShapleyValuesEstimator(t *testing.T) {
+	cases := []struct {
+		name       string
+		players    int
+		exactLimit int
+		exact      bool
+	}{
+		{"within exact limit", 3, 10, true},
+		{"at exact limit", 3, 3, true},
+		{"above exact limit", 3, 2, false},
+		{"twelve players", 12, 12, true},
+		{"coalitions beyond one word", 64, 100, false},
+	}
+	for _, c := range cases {
+		weights := make([]float64, c.players)
+		for i := range weights {
+			weights[i] = float64(i % 3)
+		}
+		shapley, stdErr, estimator := shapleyValues(c.players, additiveGame(weights), ShapleySettings{ExactLimit: c.exactLimit, Permutations: 5, Tolerance: 0})
+		if exact := estimator == "exact"; exact != c.exact {
+			t.Errorf("%s: estimator is %q", c.name, estimator)
+		}
+		if !c.exact && !strings.HasPrefix(estimator, "Monte Carlo") {
+			t.Errorf("%s: estimator is %q, want Monte Carlo", c.name, estimator)
+		}
+		if len(shapley) != c.players || len(stdErr) != c.players {
+			t.Errorf("%s: got %d values and %d standard errors for %d players", c.name, len(shapley), len(stdErr), c.players)
+		}
+		if !approxEqual(shapley, weights, 1e-9) {
+			t.Errorf("%s: Shapley values are %v, want %v", c.name, shapley, weights)
+		}
+	}
+}
@@ -4,6 +4,8 @@ go 1.14
 
 require (
 	github.com/go-echarts/go-echarts/v2 v2.2.4
+	github.com/golang/protobuf v1.3.3
+	github.com/hyperledger/fabric-protos-go v0.0.0-20200707132912-fee30f3ccd23
 	github.com/hyperledger/fabric-sdk-go v1.0.0-rc1
 	github.com/mxschmitt/golang-combinations v1.2.0
 	github.com/pa-m/sklearn v0.0.0-20200711083454-beb861ee48b1